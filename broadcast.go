@@ -0,0 +1,346 @@
+package telebot
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Сколько сообщений рассылки одновременно стоит в очереди бота. Частоту
+// ограничивает сама очередь, запас нужен, чтобы она не простаивала между
+// сообщениями рассылки.
+const broadcastWorkers = 8
+
+// Outcome - итог доставки сообщения одному получателю.
+type Outcome int
+
+const (
+	OutcomePending Outcome = iota
+	OutcomeSent
+	// Пользователь заблокировал бота или бота исключили из чата
+	OutcomeBlocked
+	OutcomeChatNotFound
+	// Аккаунт пользователя удален
+	OutcomeDeactivated
+	// Группа преобразована в супергруппу, новый id в MigrateTo
+	OutcomeMigrated
+	OutcomeFailed
+	OutcomeCancelled
+)
+
+var outcomeNames = map[Outcome]string{
+	OutcomePending:      "pending",
+	OutcomeSent:         "sent",
+	OutcomeBlocked:      "blocked",
+	OutcomeChatNotFound: "chat_not_found",
+	OutcomeDeactivated:  "deactivated",
+	OutcomeMigrated:     "migrated",
+	OutcomeFailed:       "failed",
+	OutcomeCancelled:    "cancelled",
+}
+
+func (o Outcome) String() string {
+	return outcomeNames[o]
+}
+
+// ClassifyError определяет итог доставки по ошибке отправки.
+func ClassifyError(err error) Outcome {
+	if err == nil {
+		return OutcomeSent
+	}
+	apiErr, ok := errors.Cause(err).(*APIError)
+	if !ok {
+		return OutcomeFailed
+	}
+
+	description := strings.ToLower(apiErr.Description)
+	switch {
+	case apiErr.MigrateTo != 0 || strings.Contains(description, "upgraded to a supergroup"):
+		return OutcomeMigrated
+	case strings.Contains(description, "user is deactivated"):
+		return OutcomeDeactivated
+	case strings.Contains(description, "chat not found"):
+		return OutcomeChatNotFound
+	case strings.Contains(description, "blocked by the user"),
+		strings.Contains(description, "bot was kicked"),
+		strings.Contains(description, "bot is not a member"):
+		return OutcomeBlocked
+	}
+	return OutcomeFailed
+}
+
+// BroadcastResult - итог доставки одному получателю.
+type BroadcastResult struct {
+	Recipient Recipient
+	Outcome   Outcome
+	Err       error
+	// Новый id чата для OutcomeMigrated
+	MigrateTo int64
+}
+
+// BroadcastProgress - текущее состояние рассылки.
+type BroadcastProgress struct {
+	Total     int
+	Sent      int
+	Failed    int
+	Cancelled int
+	Pending   int
+	// Количество получателей по итогам доставки
+	Outcomes map[Outcome]int
+}
+
+// BroadcastReport - итоговый отчет рассылки. Results идут в порядке получателей.
+type BroadcastReport struct {
+	Started  time.Time
+	Finished time.Time
+	Progress BroadcastProgress
+	Results  []BroadcastResult
+}
+
+// Broadcast - рассылка одного сообщения списку получателей.
+type Broadcast struct {
+	bot     *Bot
+	message func(to Recipient) Request
+
+	mu        sync.Mutex
+	resumed   *sync.Cond
+	paused    bool
+	cancelled bool
+	next      int
+	results   []BroadcastResult
+	progress  BroadcastProgress
+	started   time.Time
+	finished  time.Time
+	done      chan struct{}
+}
+
+// Broadcast запускает рассылку. message строит запрос для каждого получателя,
+// Callback запроса вызывается как обычно. Сообщения отправляются через
+// очередь бота Deferred() с PriorityLow, поэтому не задерживают более
+// срочные сообщения; цикл отправки очереди должен быть запущен.
+func (b *Bot) Broadcast(recipients []Recipient, message func(to Recipient) Request) *Broadcast {
+	bc := &Broadcast{
+		bot:     b,
+		message: message,
+		results: make([]BroadcastResult, len(recipients)),
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	bc.resumed = sync.NewCond(&bc.mu)
+
+	bc.progress = BroadcastProgress{
+		Total:    len(recipients),
+		Pending:  len(recipients),
+		Outcomes: map[Outcome]int{OutcomePending: len(recipients)},
+	}
+	for i, r := range recipients {
+		bc.results[i] = BroadcastResult{Recipient: r}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < broadcastWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bc.work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		bc.finish()
+	}()
+
+	return bc
+}
+
+// Progress возвращает количество отправленных, неудачных и ожидающих сообщений.
+func (bc *Broadcast) Progress() BroadcastProgress {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.progress.copy()
+}
+
+// Pause приостанавливает рассылку после отправки текущих сообщений.
+func (bc *Broadcast) Pause() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.paused = true
+}
+
+// Resume продолжает приостановленную рассылку.
+func (bc *Broadcast) Resume() {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.paused = false
+	bc.resumed.Broadcast()
+}
+
+// Cancel отменяет рассылку: сообщения рассылки удаляются из очереди бота
+// и получают OutcomeCancelled. Сообщения, которые отправляются в момент
+// отмены, получат настоящий итог отправки.
+func (bc *Broadcast) Cancel() {
+	bc.mu.Lock()
+	bc.cancelled = true
+	bc.resumed.Broadcast()
+	bc.mu.Unlock()
+
+	bc.bot.Deferred().cancelRequests(bc.owns)
+}
+
+// Done закрывается по окончании рассылки.
+func (bc *Broadcast) Done() <-chan struct{} {
+	return bc.done
+}
+
+// Wait дожидается окончания рассылки и возвращает отчет.
+func (bc *Broadcast) Wait() BroadcastReport {
+	<-bc.done
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	results := make([]BroadcastResult, len(bc.results))
+	copy(results, bc.results)
+	return BroadcastReport{
+		Started:  bc.started,
+		Finished: bc.finished,
+		Progress: bc.progress.copy(),
+		Results:  results,
+	}
+}
+
+func (bc *Broadcast) work() {
+	for {
+		bc.mu.Lock()
+		for bc.paused && !bc.cancelled {
+			bc.resumed.Wait()
+		}
+		if bc.cancelled || bc.next >= len(bc.results) {
+			bc.mu.Unlock()
+			return
+		}
+		i := bc.next
+		bc.next++
+		recipient := bc.results[i].Recipient
+		bc.mu.Unlock()
+
+		outcome, err := OutcomeCancelled, bc.deliver(recipient)
+		if err != ErrCancelled {
+			outcome = ClassifyError(err)
+		} else {
+			err = nil
+		}
+
+		bc.mu.Lock()
+		bc.setOutcome(i, outcome, err)
+		bc.mu.Unlock()
+	}
+}
+
+// deliver ставит сообщение в очередь бота и ждет результата отправки.
+// Временные ошибки, в том числе 429, повторяет очередь. Если рассылку
+// отменили до отправки, возвращает ErrCancelled.
+func (bc *Broadcast) deliver(recipient Recipient) error {
+	request := &broadcastRequest{
+		Request:   bc.message(recipient),
+		broadcast: bc,
+		result:    make(chan error, 1),
+	}
+	err := bc.bot.Deferred().Enqueue(&DeferredMessage{
+		Request:  request,
+		Priority: PriorityLow,
+	})
+	if err != nil {
+		request.Request.Done(err)
+		return err
+	}
+
+	// Cancel мог удалить сообщения рассылки раньше, чем это попало в очередь
+	if bc.isCancelled() {
+		bc.bot.Deferred().cancelRequests(bc.owns)
+	}
+	return <-request.result
+}
+
+func (bc *Broadcast) isCancelled() bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.cancelled
+}
+
+// owns говорит, что запрос в очереди бота принадлежит этой рассылке.
+func (bc *Broadcast) owns(r Request) bool {
+	request, ok := r.(*broadcastRequest)
+	return ok && request.broadcast == bc
+}
+
+// broadcastRequest передает рассылке результат отправки запроса.
+// Такой запрос не сохраняется в DeferredStore: после перезапуска
+// рассылку некому продолжить.
+type broadcastRequest struct {
+	Request
+	broadcast *Broadcast
+	result    chan error
+}
+
+// Send не отправляет запрос отмененной рассылки, например вернувшийся
+// в очередь для повтора после отмены.
+func (r *broadcastRequest) Send(b *Bot) error {
+	if r.broadcast.isCancelled() {
+		return ErrCancelled
+	}
+	return r.Request.Send(b)
+}
+
+func (r *broadcastRequest) Done(err error) {
+	r.Request.Done(err)
+	r.result <- err
+}
+
+func (bc *Broadcast) setOutcome(i int, outcome Outcome, err error) {
+	result := &bc.results[i]
+	bc.progress.Outcomes[result.Outcome]--
+	bc.progress.Outcomes[outcome]++
+
+	if result.Outcome == OutcomePending {
+		bc.progress.Pending--
+	}
+	switch outcome {
+	case OutcomeSent:
+		bc.progress.Sent++
+	case OutcomeCancelled:
+		bc.progress.Cancelled++
+	default:
+		bc.progress.Failed++
+	}
+
+	result.Outcome = outcome
+	result.Err = err
+	if apiErr, ok := errors.Cause(err).(*APIError); ok {
+		result.MigrateTo = apiErr.MigrateTo
+	}
+}
+
+func (bc *Broadcast) finish() {
+	bc.mu.Lock()
+	for i := bc.next; i < len(bc.results); i++ {
+		bc.setOutcome(i, OutcomeCancelled, nil)
+	}
+	bc.finished = time.Now()
+	bc.mu.Unlock()
+
+	close(bc.done)
+}
+
+func (p BroadcastProgress) copy() BroadcastProgress {
+	outcomes := make(map[Outcome]int, len(p.Outcomes))
+	for outcome, n := range p.Outcomes {
+		if n > 0 {
+			outcomes[outcome] = n
+		}
+	}
+	p.Outcomes = outcomes
+	return p
+}
@@ -0,0 +1,134 @@
+package telebot
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+)
+
+type testRequest struct {
+	to   Recipient
+	err  error
+	sent *int32
+}
+
+func (r *testRequest) Chat() Recipient { return r.to }
+func (r *testRequest) Done(err error)  {}
+
+func (r *testRequest) Send(b *Bot) error {
+	atomic.AddInt32(r.sent, 1)
+	return r.err
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string]Outcome{
+		`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`:                                                                OutcomeBlocked,
+		`{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`:                                                                           OutcomeChatNotFound,
+		`{"ok":false,"error_code":403,"description":"Forbidden: user is deactivated"}`:                                                                        OutcomeDeactivated,
+		`{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-100123}}`: OutcomeMigrated,
+		`{"ok":false,"error_code":400,"description":"Bad Request: message text is empty"}`:                                                                    OutcomeFailed,
+	}
+	for response, outcome := range cases {
+		if got := ClassifyError(newAPIError([]byte(response))); got != outcome {
+			t.Errorf("Expected %s, got %s for %s", outcome, got, response)
+		}
+	}
+	if ClassifyError(errors.New("connection reset")) != OutcomeFailed || ClassifyError(nil) != OutcomeSent {
+		t.Fatal("Network errors must fail, nil error must be sent.")
+	}
+	blocked := newAPIError([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+	if got := ClassifyError(pkgerrors.Wrap(blocked, "send")); got != OutcomeBlocked {
+		t.Fatal("Wrapped API errors must be classified, got", got)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	b := &Bot{Limiter: NewRateLimiter(RateLimits{})}
+	go b.Deferred().Run(1000)
+	defer b.Deferred().Stop(context.Background())
+	migrated := newAPIError([]byte(`{"ok":false,"error_code":400,"description":"Bad Request: group chat was upgraded to a supergroup chat","parameters":{"migrate_to_chat_id":-100123}}`))
+
+	var sent int32
+	recipients := []Recipient{User{ID: 1}, Chat{ID: -5, Type: "group"}, User{ID: 2}}
+	report := b.Broadcast(recipients, func(to Recipient) Request {
+		r := &testRequest{to: to, sent: &sent}
+		if to.Destination() == "-5" {
+			r.err = migrated
+		}
+		return r
+	}).Wait()
+
+	p := report.Progress
+	if p.Total != 3 || p.Sent != 2 || p.Failed != 1 || p.Cancelled != 0 || p.Pending != 0 || p.Outcomes[OutcomeMigrated] != 1 {
+		t.Fatal("Wrong progress:", p)
+	}
+	if r := report.Results[1]; r.Outcome != OutcomeMigrated || r.MigrateTo != -100123 {
+		t.Fatal("Migration must be reported with the new chat id:", r)
+	}
+
+	bc := b.Broadcast(recipients, func(to Recipient) Request {
+		return &testRequest{to: to, sent: &sent}
+	})
+	bc.Pause()
+	bc.Cancel()
+	report = bc.Wait()
+	p = report.Progress
+	if p.Pending != 0 || p.Failed != 0 || p.Sent+p.Cancelled != 3 || p.Cancelled != p.Outcomes[OutcomeCancelled] {
+		t.Fatal("Cancelled recipients must be reported separately:", p)
+	}
+}
+
+func TestBroadcastPriority(t *testing.T) {
+	b := &Bot{}
+	s := b.Deferred()
+	s.limiter = NewRateLimiter(RateLimits{})
+
+	var sent int32
+	bc := b.Broadcast([]Recipient{User{ID: 1}}, func(to Recipient) Request {
+		return &testRequest{to: to, sent: &sent}
+	})
+	for s.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Рассылка идет через очередь бота и уступает срочным сообщениям
+	s.Enqueue(&DeferredMessage{Request: &testRequest{to: User{ID: 2}, sent: &sent}, Priority: PriorityUrgent})
+	first, _ := s.next()
+	second, _ := s.next()
+	if first.Priority != PriorityUrgent || second.Priority != PriorityLow {
+		t.Fatal("Broadcast must be sent with low priority:", first.Priority, second.Priority)
+	}
+	s.send(second)
+	if p := bc.Wait().Progress; p.Sent != 1 || atomic.LoadInt32(&sent) != 1 {
+		t.Fatal("Broadcast message must be sent by the queue:", p)
+	}
+
+	bc = b.Broadcast([]Recipient{User{ID: 3}}, func(to Recipient) Request {
+		return &testRequest{to: to, sent: &sent}
+	})
+	for s.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	bc.Cancel()
+	if p := bc.Wait().Progress; p.Cancelled != 1 || s.Len() != 0 {
+		t.Fatal("Cancel must remove queued messages:", p, s.Len())
+	}
+
+	// Сообщение, вернувшееся в очередь после отмены, не отправляется
+	bc = b.Broadcast([]Recipient{User{ID: 4}}, func(to Recipient) Request {
+		return &testRequest{to: to, sent: &sent}
+	})
+	for s.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	inFlight, _ := s.next()
+	bc.Cancel()
+	s.send(inFlight)
+	if p := bc.Wait().Progress; p.Cancelled != 1 || p.Sent != 0 || atomic.LoadInt32(&sent) != 1 {
+		t.Fatal("Cancelled broadcast must not be sent:", p)
+	}
+}
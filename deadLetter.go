@@ -0,0 +1,298 @@
+package telebot
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrDeadLetterNotFound возвращается для несуществующего сообщения в DeadLetterStore
+var ErrDeadLetterNotFound = errors.New("telebot: dead letter not found")
+
+// RetryPolicy задает повторы отправки отложенного сообщения при временных
+// ошибках: 429 Too Many Requests, 5xx и ошибках сети. Пауза перед повтором
+// удваивается от MinBackoff до MaxBackoff, но не меньше retry_after из
+// ответа Telegram.
+type RetryPolicy struct {
+	// Общее количество попыток, 1 - без повторов
+	MaxAttempts int           `json:"max_attempts"`
+	MinBackoff  time.Duration `json:"min_backoff"`
+	MaxBackoff  time.Duration `json:"max_backoff"`
+}
+
+// DefaultRetryPolicy используется для сообщений без собственной политики.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	MinBackoff:  time.Second,
+	MaxBackoff:  5 * time.Minute,
+}
+
+// backoff возвращает паузу перед следующей попыткой после attempts неудачных.
+func (p RetryPolicy) backoff(attempts int, err error) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if apiErr, ok := errors.Cause(err).(*APIError); ok {
+		if retryAfter := time.Duration(apiErr.RetryAfter) * time.Second; retryAfter > d {
+			d = retryAfter
+		}
+	}
+	return d
+}
+
+// IsTransient говорит, что запрос, завершившийся ошибкой err, можно повторить.
+func IsTransient(err error) bool {
+	cause := errors.Cause(err)
+	switch e := cause.(type) {
+	case *APIError:
+		return e.Code == 429 || e.Code >= 500
+	case net.Error:
+		return true
+	}
+	return cause == io.EOF || cause == io.ErrUnexpectedEOF
+}
+
+// DeadLetter - сообщение, которое не удалось отправить.
+type DeadLetter struct {
+	ID uint64 `json:"id"`
+	// Последняя ошибка отправки
+	Error    string        `json:"error"`
+	Code     int           `json:"code,omitempty"`
+	Attempts int           `json:"attempts"`
+	FailedAt time.Time     `json:"failed_at"`
+	Message  StoredMessage `json:"message"`
+}
+
+// DeadLetterStore хранит сообщения, отправка которых окончательно не удалась.
+// Попадают туда только запросы, реализующие StorableRequest.
+type DeadLetterStore interface {
+	// Add сохраняет сообщение и присваивает ему ID.
+	Add(dl *DeadLetter) error
+	// List возвращает сообщения в порядке добавления.
+	List() ([]DeadLetter, error)
+	// Remove удаляет сообщение, ErrDeadLetterNotFound - если его нет.
+	Remove(id uint64) error
+}
+
+func newDeadLetter(dm *DeferredMessage, err error, now time.Time) (*DeadLetter, error) {
+	sm, marshalErr := newStoredMessage(dm)
+	if marshalErr != nil || sm == nil {
+		return nil, marshalErr
+	}
+	dl := &DeadLetter{
+		Error:    err.Error(),
+		Attempts: dm.attempts,
+		FailedAt: now,
+		Message:  *sm,
+	}
+	if apiErr, ok := errors.Cause(err).(*APIError); ok {
+		dl.Code = apiErr.Code
+	}
+	return dl, nil
+}
+
+// SetDeadLetterStore подключает хранилище для сообщений, которые не удалось
+// отправить. Без него такие сообщения только передаются в Callback.
+// В обоих случаях они удаляются из DeferredStore.
+func (s *DeferredSender) SetDeadLetterStore(store DeadLetterStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deadLetters = store
+}
+
+// SetRetryPolicy задает политику повторов для сообщений без собственной.
+func (s *DeferredSender) SetRetryPolicy(p RetryPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retryPolicy = p
+}
+
+// DeadLetters возвращает сообщения, которые не удалось отправить.
+func (s *DeferredSender) DeadLetters() ([]DeadLetter, error) {
+	store, err := s.deadLetterStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.List()
+}
+
+// Requeue снова ставит сообщение из DeadLetterStore в очередь с новым
+// счетчиком попыток. Callback исходного сообщения не восстанавливается.
+func (s *DeferredSender) Requeue(id uint64) error {
+	store, err := s.deadLetterStore()
+	if err != nil {
+		return err
+	}
+	letters, err := store.List()
+	if err != nil {
+		return err
+	}
+	for _, dl := range letters {
+		if dl.ID != id {
+			continue
+		}
+		dm, err := dl.Message.deferredMessage()
+		if err != nil {
+			return err
+		}
+		dm.storeID = 0
+		if err := s.Enqueue(&dm); err != nil {
+			return err
+		}
+		return store.Remove(id)
+	}
+	return ErrDeadLetterNotFound
+}
+
+// Purge удаляет сообщения из DeadLetterStore, без аргументов - все.
+func (s *DeferredSender) Purge(ids ...uint64) error {
+	store, err := s.deadLetterStore()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		letters, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, dl := range letters {
+			ids = append(ids, dl.ID)
+		}
+	}
+	for _, id := range ids {
+		if err := store.Remove(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *DeferredSender) deadLetterStore() (DeadLetterStore, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deadLetters == nil {
+		return nil, errors.New("telebot: dead letter store is not set")
+	}
+	return s.deadLetters, nil
+}
+
+// MemoryDeadLetterStore хранит сообщения в памяти.
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	nextID  uint64
+	letters map[uint64]DeadLetter
+}
+
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{nextID: 1, letters: make(map[uint64]DeadLetter)}
+}
+
+func (s *MemoryDeadLetterStore) Add(dl *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dl.ID = s.nextID
+	s.nextID++
+	s.letters[dl.ID] = *dl
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) List() ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	letters := make([]DeadLetter, 0, len(s.letters))
+	for _, dl := range s.letters {
+		letters = append(letters, dl)
+	}
+	sort.Slice(letters, func(i, j int) bool {
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, nil
+}
+
+func (s *MemoryDeadLetterStore) Remove(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.letters[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(s.letters, id)
+	return nil
+}
+
+// FileDeadLetterStore хранит сообщения в JSON файле, перезаписывая его
+// целиком при каждом изменении.
+type FileDeadLetterStore struct {
+	MemoryDeadLetterStore
+	path string
+	// Порядок изменений в памяти и записей в файл совпадает
+	fileMu sync.Mutex
+}
+
+// OpenFileDeadLetterStore открывает файл, создавая его при необходимости.
+func OpenFileDeadLetterStore(path string) (*FileDeadLetterStore, error) {
+	s := &FileDeadLetterStore{path: path}
+	s.nextID = 1
+	s.letters = make(map[uint64]DeadLetter)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		var letters []DeadLetter
+		if err := json.Unmarshal(data, &letters); err != nil {
+			return nil, err
+		}
+		for _, dl := range letters {
+			s.letters[dl.ID] = dl
+			if dl.ID >= s.nextID {
+				s.nextID = dl.ID + 1
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *FileDeadLetterStore) Add(dl *DeadLetter) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := s.MemoryDeadLetterStore.Add(dl); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *FileDeadLetterStore) Remove(id uint64) error {
+	s.fileMu.Lock()
+	defer s.fileMu.Unlock()
+	if err := s.MemoryDeadLetterStore.Remove(id); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+func (s *FileDeadLetterStore) flush() error {
+	letters, _ := s.List()
+	data, err := json.Marshal(letters)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
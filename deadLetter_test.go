@@ -0,0 +1,97 @@
+package telebot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	transient := []error{
+		&APIError{Code: 429, RetryAfter: 3},
+		&APIError{Code: 502},
+		&timeoutError{},
+	}
+	for _, err := range transient {
+		if !IsTransient(err) {
+			t.Error("Expected transient error:", err)
+		}
+	}
+	if IsTransient(&APIError{Code: 403}) || IsTransient(errors.New("bad request")) || IsTransient(nil) {
+		t.Fatal("Permanent errors must not be retried.")
+	}
+
+	p := RetryPolicy{MaxAttempts: 5, MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	if p.backoff(1, nil) != time.Second || p.backoff(3, nil) != 4*time.Second || p.backoff(10, nil) != 5*time.Second {
+		t.Fatal("Backoff must double up to MaxBackoff.")
+	}
+	if p.backoff(1, &APIError{Code: 429, RetryAfter: 30}) != 30*time.Second {
+		t.Fatal("Backoff must respect retry_after.")
+	}
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestDeadLetters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-dead")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead.json")
+
+	store, err := OpenFileDeadLetterStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	s.SetDeadLetterStore(store)
+	s.SetRetryPolicy(RetryPolicy{MaxAttempts: 2})
+
+	var result error
+	s.Enqueue(&DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "hello",
+		Callback: func(_ *MsgResult, err error) { result = err }}})
+	s.Enqueue(&DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "second"}})
+
+	dm, _ := s.next()
+	if !s.retry(&dm, &APIError{Code: 500}) {
+		t.Fatal("Transient error must be retried.")
+	}
+	dm, _ = s.next()
+	if dm.Request.(*TextRequest).Text != "hello" || dm.attempts != 1 {
+		t.Fatal("Retried message must keep its place in the chat queue:", dm)
+	}
+	if s.retry(&dm, &APIError{Code: 500}) {
+		t.Fatal("Retries must stop after MaxAttempts.")
+	}
+	s.deadLetter(dm, &APIError{Code: 500, Description: "Internal Server Error"})
+	dm.Request.Done(&APIError{Code: 500})
+	if result == nil {
+		t.Fatal("Callback must receive the final error.")
+	}
+
+	store, _ = OpenFileDeadLetterStore(path)
+	s.SetDeadLetterStore(store)
+	letters, err := s.DeadLetters()
+	if err != nil || len(letters) != 1 || letters[0].Attempts != 2 || letters[0].Code != 500 {
+		t.Fatal("Dead letter must record attempts and the last error:", letters, err)
+	}
+
+	if err := s.Requeue(letters[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 2 {
+		t.Fatal("Requeued message must be back in the queue.")
+	}
+	if err := s.Purge(letters[0].ID); err != ErrDeadLetterNotFound {
+		t.Fatal("Requeued message must be removed from dead letters, got", err)
+	}
+}
@@ -0,0 +1,149 @@
+package telebot
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// MaxMessageLength - максимальная длина текста сообщения в Telegram
+// в единицах UTF-16.
+const MaxMessageLength = 4096
+
+// Batching задает объединение текстовых сообщений одного чата с одинаковым
+// DeferredMessage.BatchKey в одно сообщение.
+type Batching struct {
+	// Сколько сообщение ждет в очереди, чтобы к нему присоединились другие
+	Window time.Duration
+	// Join собирает текст объединенного сообщения, по умолчанию DefaultBatchJoin.
+	// Результат длиннее MaxMessageLength не отправляется: оставшиеся
+	// сообщения уйдут следующим пакетом.
+	Join func(texts []string) string
+}
+
+// DefaultBatchJoin разделяет сообщения пустой строкой.
+func DefaultBatchJoin(texts []string) string {
+	return strings.Join(texts, "\n\n")
+}
+
+// SetBatching включает объединение сообщений. Объединяются только
+// TextRequest с непустым BatchKey, одинаковыми ParseMode и флагами и без
+// клавиатуры и ответа на сообщение. Нулевой Batching выключает объединение.
+func (s *DeferredSender) SetBatching(b Batching) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if b.Join == nil {
+		b.Join = DefaultBatchJoin
+	}
+	s.batching = b
+}
+
+// batchRequest отправляет объединенные сообщения одним и передает
+// результат в Callback каждого из них.
+type batchRequest struct {
+	text  *TextRequest
+	parts []DeferredMessage
+}
+
+func (r *batchRequest) Chat() Recipient { return r.text.To }
+
+func (r *batchRequest) Send(b *Bot) error {
+	return r.text.Send(b)
+}
+
+func (r *batchRequest) Done(err error) {
+	for _, part := range r.parts {
+		part.Request.(*TextRequest).result = r.text.result
+		part.Request.Done(err)
+	}
+}
+
+// batchText возвращает текст сообщения, которое можно объединять.
+func (dm *DeferredMessage) batchText() (*TextRequest, bool) {
+	if dm.BatchKey == "" {
+		return nil, false
+	}
+	text, ok := dm.Request.(*TextRequest)
+	if !ok {
+		return nil, false
+	}
+	o := text.Options
+	if o != nil && (o.ReplyTo.ID != 0 || !reflect.DeepEqual(o.ReplyMarkup, ReplyMarkup{})) {
+		return nil, false
+	}
+	return text, true
+}
+
+// batchFlags - настройки, которые должны совпадать у объединяемых сообщений.
+type batchFlags struct {
+	parseMode ParseMode
+	silent    bool
+	noPreview bool
+}
+
+func newBatchFlags(o *SendOptions) batchFlags {
+	if o == nil {
+		return batchFlags{}
+	}
+	return batchFlags{o.ParseMode, o.DisableNotification, o.DisableWebPagePreview}
+}
+
+// batch присоединяет к сообщению dm идущие за ним подряд сообщения его чата
+// с тем же BatchKey, пока текст помещается в MaxMessageLength. Сообщения
+// после первого неподходящего не присоединяются, чтобы не обогнать его.
+// Вызывается под s.mu.
+func (s *DeferredSender) batch(lane *deferredLane, dm DeferredMessage) DeferredMessage {
+	first, ok := dm.batchText()
+	if !ok || s.batching.Join == nil {
+		return dm
+	}
+	cq, ok := lane.chats[dm.Recipient.Destination()]
+	if !ok {
+		return dm
+	}
+
+	parts := []DeferredMessage{dm}
+	texts := []string{first.Text}
+	joined := ""
+	for len(cq.messages) > 0 {
+		next := cq.messages[0]
+		text, ok := next.batchText()
+		if !ok || next.BatchKey != dm.BatchKey || newBatchFlags(text.Options) != newBatchFlags(first.Options) {
+			break
+		}
+		candidate := s.batching.Join(append(texts, text.Text))
+		if utf16Len(candidate) > MaxMessageLength {
+			break
+		}
+		parts = append(parts, next)
+		texts = append(texts, text.Text)
+		joined = candidate
+
+		lane.removeAt(cq, 0)
+		s.size--
+	}
+	if len(parts) == 1 {
+		return dm
+	}
+
+	merged := dm
+	merged.Request = &batchRequest{
+		text:  &TextRequest{To: first.To, Text: joined, Options: first.Options},
+		parts: parts,
+	}
+	return merged
+}
+
+// utf16Len возвращает длину строки в единицах UTF-16, в которых Telegram
+// считает длину текста. Символы вне BMP занимают две единицы.
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,164 @@
+package telebot
+
+import (
+	"container/heap"
+	"time"
+)
+
+// chatQueue - сообщения одного чата в порядке постановки в очередь.
+type chatQueue struct {
+	chatId   string
+	messages []DeferredMessage
+	// Время, раньше которого чату нельзя отправлять
+	readyAt time.Time
+	// Порядковый номер постановки в очередь готовности: из чатов с равным
+	// readyAt первым обслуживается тот, который ждет дольше
+	seq   uint64
+	index int
+}
+
+// readyQueue - куча чатов, упорядоченная по readyAt и seq. После отправки
+// чат получает новый seq и встает за остальными готовыми чатами, поэтому
+// чаты обслуживаются по кругу.
+type readyQueue []*chatQueue
+
+func (q readyQueue) Len() int { return len(q) }
+
+func (q readyQueue) Less(i, j int) bool {
+	if !q[i].readyAt.Equal(q[j].readyAt) {
+		return q[i].readyAt.Before(q[j].readyAt)
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q readyQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *readyQueue) Push(x interface{}) {
+	cq := x.(*chatQueue)
+	cq.index = len(*q)
+	*q = append(*q, cq)
+}
+
+func (q *readyQueue) Pop() interface{} {
+	old := *q
+	cq := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	cq.index = -1
+	return cq
+}
+
+// deferredLane - очереди сообщений одного приоритета по чатам.
+// Внутри чата сообщения отправляются в порядке постановки в очередь.
+type deferredLane struct {
+	priority Priority
+	chats    map[string]*chatQueue
+	ready    readyQueue
+	// Сколько раз подряд готовое сообщение этой очереди пропускалось
+	skipped int
+}
+
+func newDeferredLane(priority Priority) *deferredLane {
+	return &deferredLane{priority: priority, chats: make(map[string]*chatQueue)}
+}
+
+// push добавляет сообщение в конец очереди чата.
+func (lane *deferredLane) push(dm DeferredMessage, now time.Time, seq uint64) {
+	chatId := dm.Recipient.Destination()
+	if cq, ok := lane.chats[chatId]; ok {
+		cq.messages = append(cq.messages, dm)
+		return
+	}
+	cq := &chatQueue{chatId: chatId, messages: []DeferredMessage{dm}, readyAt: later(now, dm.notBefore), seq: seq}
+	lane.chats[chatId] = cq
+	heap.Push(&lane.ready, cq)
+}
+
+// pushFront возвращает сообщение в начало очереди чата.
+func (lane *deferredLane) pushFront(dm DeferredMessage, now time.Time, seq uint64) {
+	cq, ok := lane.chats[dm.Recipient.Destination()]
+	if !ok {
+		lane.push(dm, now, seq)
+		return
+	}
+	cq.messages = append([]DeferredMessage{dm}, cq.messages...)
+	lane.reschedule(cq, later(cq.readyAt, dm.notBefore), cq.seq)
+}
+
+// peek возвращает чат, которому можно отправить сообщение прямо сейчас.
+// Чаты, которым не дает отправить ограничитель, переносятся на время,
+// когда он разрешит отправку.
+func (lane *deferredLane) peek(limiter *RateLimiter, now time.Time, seq func() uint64) (*chatQueue, bool) {
+	for len(lane.ready) > 0 {
+		cq := lane.ready[0]
+		if cq.readyAt.After(now) {
+			return nil, false
+		}
+		global, chat := limiter.delays(cq.messages[0].Recipient)
+		if global > 0 {
+			// Общий лимит не дает отправить ни одному чату
+			return nil, false
+		}
+		if chat == 0 {
+			return cq, true
+		}
+		lane.reschedule(cq, now.Add(chat), seq())
+	}
+	return nil, false
+}
+
+// pop достает первое сообщение чата и ставит чат в конец круга.
+func (lane *deferredLane) pop(cq *chatQueue, now time.Time, seq uint64) DeferredMessage {
+	dm := cq.messages[0]
+	cq.messages[0] = DeferredMessage{}
+	cq.messages = cq.messages[1:]
+
+	if len(cq.messages) == 0 {
+		heap.Remove(&lane.ready, cq.index)
+		delete(lane.chats, cq.chatId)
+	} else {
+		lane.reschedule(cq, later(now, cq.messages[0].notBefore), seq)
+	}
+	return dm
+}
+
+// removeAt удаляет из очереди чата i-е сообщение. Последнее сообщение
+// удаляется вместе с очередью чата.
+func (lane *deferredLane) removeAt(cq *chatQueue, i int) {
+	if len(cq.messages) == 1 {
+		lane.remove(cq.chatId)
+		cq.messages = nil
+		return
+	}
+	copy(cq.messages[i:], cq.messages[i+1:])
+	cq.messages[len(cq.messages)-1] = DeferredMessage{}
+	cq.messages = cq.messages[:len(cq.messages)-1]
+}
+
+// remove удаляет очередь чата целиком.
+func (lane *deferredLane) remove(chatId string) []DeferredMessage {
+	cq, ok := lane.chats[chatId]
+	if !ok {
+		return nil
+	}
+	heap.Remove(&lane.ready, cq.index)
+	delete(lane.chats, chatId)
+	return cq.messages
+}
+
+func (lane *deferredLane) reschedule(cq *chatQueue, readyAt time.Time, seq uint64) {
+	cq.readyAt = readyAt
+	cq.seq = seq
+	heap.Fix(&lane.ready, cq.index)
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
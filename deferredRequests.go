@@ -0,0 +1,524 @@
+package telebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Request - запрос к API, который можно поставить в отложенную очередь.
+// Результат запроса передается в типизированный Callback конкретного типа.
+type Request interface {
+	// Chat возвращает чат, по которому запрос ставится в очередь
+	// и ограничивается частота.
+	Chat() Recipient
+	// Send выполняет запрос и запоминает его результат.
+	Send(b *Bot) error
+	// Done передает окончательный результат в Callback запроса.
+	Done(err error)
+}
+
+// StorableRequest - запрос, который можно сохранить в DeferredStore.
+// Запрос сериализуется в JSON, получатель сохраняется отдельно и
+// восстанавливается через SetChat. Запросы, не реализующие этот
+// интерфейс, хранятся только в памяти.
+type StorableRequest interface {
+	Request
+	// Kind - имя типа запроса, под которым он зарегистрирован в RegisterRequest.
+	Kind() string
+	SetChat(r Recipient)
+}
+
+var (
+	requestKindsMu sync.RWMutex
+	requestKinds   = map[string]func() StorableRequest{
+		"text":     func() StorableRequest { return &TextRequest{} },
+		"photo":    func() StorableRequest { return &PhotoRequest{} },
+		"audio":    func() StorableRequest { return &AudioRequest{} },
+		"document": func() StorableRequest { return &DocumentRequest{} },
+		"sticker":  func() StorableRequest { return &StickerRequest{} },
+		"video":    func() StorableRequest { return &VideoRequest{} },
+		"location": func() StorableRequest { return &LocationRequest{} },
+		"venue":    func() StorableRequest { return &VenueRequest{} },
+		"forward":  func() StorableRequest { return &ForwardRequest{} },
+		"edit":     func() StorableRequest { return &EditTextRequest{} },
+		"delete":   func() StorableRequest { return &DeleteRequest{} },
+	}
+)
+
+// RegisterRequest регистрирует собственный тип запроса, чтобы его можно
+// было восстановить из DeferredStore.
+func RegisterRequest(kind string, factory func() StorableRequest) {
+	requestKindsMu.Lock()
+	defer requestKindsMu.Unlock()
+	requestKinds[kind] = factory
+}
+
+func newRequest(kind string) (StorableRequest, error) {
+	requestKindsMu.RLock()
+	defer requestKindsMu.RUnlock()
+	factory, ok := requestKinds[kind]
+	if !ok {
+		return nil, fmt.Errorf("telebot: unknown request kind '%s'", kind)
+	}
+	return factory(), nil
+}
+
+// TextRequest отправляет текстовое сообщение.
+type TextRequest struct {
+	To       Recipient `json:"-"`
+	Text     string
+	Options  *SendOptions
+	Callback func(*MsgResult, error) `json:"-"`
+
+	result *MsgResult
+}
+
+func (r *TextRequest) Chat() Recipient      { return r.To }
+func (r *TextRequest) SetChat(to Recipient) { r.To = to }
+func (r *TextRequest) Kind() string         { return "text" }
+
+func (r *TextRequest) Send(b *Bot) (err error) {
+	r.result, err = b.SendMessage(r.To, r.Text, r.Options)
+	return err
+}
+
+func (r *TextRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(r.result, err)
+	}
+}
+
+// PhotoRequest отправляет фото.
+type PhotoRequest struct {
+	To       Recipient
+	Photo    *Photo
+	Options  *SendOptions
+	Callback func(*Photo, error)
+}
+
+func (r *PhotoRequest) Chat() Recipient      { return r.To }
+func (r *PhotoRequest) SetChat(to Recipient) { r.To = to }
+func (r *PhotoRequest) Kind() string         { return "photo" }
+
+func (r *PhotoRequest) Send(b *Bot) error {
+	return b.SendPhoto(r.To, r.Photo, r.Options)
+}
+
+func (r *PhotoRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(r.Photo, err)
+	}
+}
+
+func (r *PhotoRequest) MarshalJSON() ([]byte, error) {
+	if r.Photo == nil {
+		return nil, errNoFile(r)
+	}
+	return json.Marshal(storedFileRequest{
+		File:    &StoredFile{FileID: r.Photo.FileID, Path: r.Photo.filename, Url: r.Photo.Url, Caption: r.Photo.Caption},
+		Options: r.Options,
+	})
+}
+
+func (r *PhotoRequest) UnmarshalJSON(data []byte) error {
+	stored, err := unmarshalFileRequest(data)
+	if err != nil {
+		return err
+	}
+	r.Photo = &Photo{File: stored.File.file(), Url: stored.File.Url, Caption: stored.File.Caption}
+	r.Options = stored.Options
+	return nil
+}
+
+// AudioRequest отправляет аудио.
+type AudioRequest struct {
+	To       Recipient
+	Audio    *Audio
+	Options  *SendOptions
+	Callback func(*Audio, error)
+}
+
+func (r *AudioRequest) Chat() Recipient      { return r.To }
+func (r *AudioRequest) SetChat(to Recipient) { r.To = to }
+func (r *AudioRequest) Kind() string         { return "audio" }
+
+func (r *AudioRequest) Send(b *Bot) error {
+	return b.SendAudio(r.To, r.Audio, r.Options)
+}
+
+func (r *AudioRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(r.Audio, err)
+	}
+}
+
+func (r *AudioRequest) MarshalJSON() ([]byte, error) {
+	if r.Audio == nil {
+		return nil, errNoFile(r)
+	}
+	return marshalFileRequest(&StoredFile{FileID: r.Audio.FileID, Path: r.Audio.filename}, r.Audio, r.Options)
+}
+
+func (r *AudioRequest) UnmarshalJSON(data []byte) error {
+	stored, err := unmarshalFileRequest(data)
+	if err != nil {
+		return err
+	}
+	r.Audio = &Audio{}
+	if err := stored.media(r.Audio, &r.Audio.File); err != nil {
+		return err
+	}
+	r.Options = stored.Options
+	return nil
+}
+
+// DocumentRequest отправляет документ.
+type DocumentRequest struct {
+	To       Recipient
+	Document *Document
+	Options  *SendOptions
+	Callback func(*Document, error)
+}
+
+func (r *DocumentRequest) Chat() Recipient      { return r.To }
+func (r *DocumentRequest) SetChat(to Recipient) { r.To = to }
+func (r *DocumentRequest) Kind() string         { return "document" }
+
+func (r *DocumentRequest) Send(b *Bot) error {
+	return b.SendDocument(r.To, r.Document, r.Options)
+}
+
+func (r *DocumentRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(r.Document, err)
+	}
+}
+
+func (r *DocumentRequest) MarshalJSON() ([]byte, error) {
+	if r.Document == nil {
+		return nil, errNoFile(r)
+	}
+	return marshalFileRequest(&StoredFile{FileID: r.Document.FileID, Path: r.Document.filename}, r.Document, r.Options)
+}
+
+func (r *DocumentRequest) UnmarshalJSON(data []byte) error {
+	stored, err := unmarshalFileRequest(data)
+	if err != nil {
+		return err
+	}
+	r.Document = &Document{}
+	if err := stored.media(r.Document, &r.Document.File); err != nil {
+		return err
+	}
+	r.Options = stored.Options
+	return nil
+}
+
+// StickerRequest отправляет стикер.
+type StickerRequest struct {
+	To       Recipient
+	Sticker  *Sticker
+	Options  *SendOptions
+	Callback func(*Sticker, error)
+}
+
+func (r *StickerRequest) Chat() Recipient      { return r.To }
+func (r *StickerRequest) SetChat(to Recipient) { r.To = to }
+func (r *StickerRequest) Kind() string         { return "sticker" }
+
+func (r *StickerRequest) Send(b *Bot) error {
+	return b.SendSticker(r.To, r.Sticker, r.Options)
+}
+
+func (r *StickerRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(r.Sticker, err)
+	}
+}
+
+func (r *StickerRequest) MarshalJSON() ([]byte, error) {
+	if r.Sticker == nil {
+		return nil, errNoFile(r)
+	}
+	return marshalFileRequest(&StoredFile{FileID: r.Sticker.FileID, Path: r.Sticker.filename}, r.Sticker, r.Options)
+}
+
+func (r *StickerRequest) UnmarshalJSON(data []byte) error {
+	stored, err := unmarshalFileRequest(data)
+	if err != nil {
+		return err
+	}
+	r.Sticker = &Sticker{}
+	if err := stored.media(r.Sticker, &r.Sticker.File); err != nil {
+		return err
+	}
+	r.Options = stored.Options
+	return nil
+}
+
+// VideoRequest отправляет видео.
+type VideoRequest struct {
+	To       Recipient
+	Video    *Video
+	Options  *SendOptions
+	Callback func(*Video, error)
+}
+
+func (r *VideoRequest) Chat() Recipient      { return r.To }
+func (r *VideoRequest) SetChat(to Recipient) { r.To = to }
+func (r *VideoRequest) Kind() string         { return "video" }
+
+func (r *VideoRequest) Send(b *Bot) error {
+	return b.SendVideo(r.To, r.Video, r.Options)
+}
+
+func (r *VideoRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(r.Video, err)
+	}
+}
+
+func (r *VideoRequest) MarshalJSON() ([]byte, error) {
+	if r.Video == nil {
+		return nil, errNoFile(r)
+	}
+	return marshalFileRequest(&StoredFile{FileID: r.Video.FileID, Path: r.Video.filename, Caption: r.Video.Caption}, r.Video, r.Options)
+}
+
+func (r *VideoRequest) UnmarshalJSON(data []byte) error {
+	stored, err := unmarshalFileRequest(data)
+	if err != nil {
+		return err
+	}
+	r.Video = &Video{}
+	if err := stored.media(r.Video, &r.Video.File); err != nil {
+		return err
+	}
+	r.Video.Caption = stored.File.Caption
+	r.Options = stored.Options
+	return nil
+}
+
+// LocationRequest отправляет точку на карте.
+type LocationRequest struct {
+	To       Recipient `json:"-"`
+	Location *Location
+	Options  *SendOptions
+	Callback func(error) `json:"-"`
+}
+
+func (r *LocationRequest) Chat() Recipient      { return r.To }
+func (r *LocationRequest) SetChat(to Recipient) { r.To = to }
+func (r *LocationRequest) Kind() string         { return "location" }
+
+func (r *LocationRequest) Send(b *Bot) error {
+	return b.SendLocation(r.To, r.Location, r.Options)
+}
+
+func (r *LocationRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// VenueRequest отправляет место.
+type VenueRequest struct {
+	To       Recipient `json:"-"`
+	Venue    *Venue
+	Options  *SendOptions
+	Callback func(error) `json:"-"`
+}
+
+func (r *VenueRequest) Chat() Recipient      { return r.To }
+func (r *VenueRequest) SetChat(to Recipient) { r.To = to }
+func (r *VenueRequest) Kind() string         { return "venue" }
+
+func (r *VenueRequest) Send(b *Bot) error {
+	return b.SendVenue(r.To, r.Venue, r.Options)
+}
+
+func (r *VenueRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// ForwardRequest пересылает сообщение.
+type ForwardRequest struct {
+	To       Recipient `json:"-"`
+	Message  Message
+	Callback func(error) `json:"-"`
+}
+
+func (r *ForwardRequest) Chat() Recipient      { return r.To }
+func (r *ForwardRequest) SetChat(to Recipient) { r.To = to }
+func (r *ForwardRequest) Kind() string         { return "forward" }
+
+func (r *ForwardRequest) Send(b *Bot) error {
+	return b.ForwardMessage(r.To, r.Message)
+}
+
+func (r *ForwardRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// EditTextRequest изменяет текст сообщения.
+type EditTextRequest struct {
+	Message  Message
+	Text     string
+	Options  *SendOptions
+	Callback func(error) `json:"-"`
+}
+
+func (r *EditTextRequest) Chat() Recipient   { return r.Message.Chat }
+func (r *EditTextRequest) SetChat(Recipient) {}
+func (r *EditTextRequest) Kind() string      { return "edit" }
+
+func (r *EditTextRequest) Send(b *Bot) error {
+	return b.EditMessageText(r.Message, r.Text, r.Options)
+}
+
+func (r *EditTextRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// DeleteRequest удаляет сообщение.
+type DeleteRequest struct {
+	Message  Message
+	Callback func(error) `json:"-"`
+}
+
+func (r *DeleteRequest) Chat() Recipient   { return r.Message.Chat }
+func (r *DeleteRequest) SetChat(Recipient) {}
+func (r *DeleteRequest) Kind() string      { return "delete" }
+
+func (r *DeleteRequest) Send(b *Bot) error {
+	return b.DeleteMessage(r.Message)
+}
+
+func (r *DeleteRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// ChatActionRequest отправляет действие в чате ("печатает..."). Не сохраняется
+// в DeferredStore: после перезапуска действие уже неактуально.
+type ChatActionRequest struct {
+	To       Recipient
+	Action   string
+	Callback func(error)
+}
+
+func (r *ChatActionRequest) Chat() Recipient { return r.To }
+
+func (r *ChatActionRequest) Send(b *Bot) error {
+	return b.SendChatAction(r.To, r.Action)
+}
+
+func (r *ChatActionRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// AnswerCallbackRequest отвечает на нажатие inline кнопки. Не сохраняется
+// в DeferredStore: после перезапуска на запрос уже нельзя ответить.
+type AnswerCallbackRequest struct {
+	Query    *Callback
+	Response *CallbackResponse
+	Callback func(error)
+}
+
+func (r *AnswerCallbackRequest) Chat() Recipient { return r.Query.Sender }
+
+func (r *AnswerCallbackRequest) Send(b *Bot) error {
+	return b.AnswerCallbackQuery(r.Query, r.Response)
+}
+
+func (r *AnswerCallbackRequest) Done(err error) {
+	if r.Callback != nil {
+		r.Callback(err)
+	}
+}
+
+// storedFileRequest - сохраняемая часть запросов с файлами.
+type storedFileRequest struct {
+	File *StoredFile `json:"file"`
+	// Описание файла: длительность, размеры, MIME-тип и т.п.
+	Media   json.RawMessage `json:"media,omitempty"`
+	Options *SendOptions    `json:"options,omitempty"`
+}
+
+func marshalFileRequest(file *StoredFile, media interface{}, options *SendOptions) ([]byte, error) {
+	data, err := json.Marshal(media)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(storedFileRequest{File: file, Media: data, Options: options})
+}
+
+// media восстанавливает описание файла в v и ссылку на файл в file.
+func (stored storedFileRequest) media(v interface{}, file *File) error {
+	if len(stored.Media) > 0 {
+		if err := json.Unmarshal(stored.Media, v); err != nil {
+			return err
+		}
+	}
+	size := file.FileSize
+	*file = stored.File.file()
+	file.FileSize = size
+	return nil
+}
+
+func errNoFile(r StorableRequest) error {
+	return fmt.Errorf("telebot: %s request has no file", r.Kind())
+}
+
+func unmarshalFileRequest(data []byte) (storedFileRequest, error) {
+	var stored storedFileRequest
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return stored, err
+	}
+	if stored.File == nil {
+		return stored, fmt.Errorf("telebot: stored request has no file")
+	}
+	return stored, stored.File.check()
+}
+
+// request возвращает запрос сообщения. Для сообщений без Request запрос
+// строится по MsgType.
+func (dm *DeferredMessage) request() (Request, error) {
+	if dm.Request != nil {
+		return dm.Request, nil
+	}
+
+	callback := dm.Callback
+	errorCallback := func(err error) {
+		if callback != nil {
+			callback(nil, err)
+		}
+	}
+
+	switch dm.MsgType {
+	case "photo":
+		return &PhotoRequest{To: dm.Recipient, Photo: dm.Photo, Options: dm.Options,
+			Callback: func(_ *Photo, err error) { errorCallback(err) }}, nil
+	case "sticker":
+		return &StickerRequest{To: dm.Recipient, Sticker: dm.Sticker, Options: dm.Options,
+			Callback: func(_ *Sticker, err error) { errorCallback(err) }}, nil
+	case "doc":
+		return &DocumentRequest{To: dm.Recipient, Document: dm.Doc, Options: dm.Options,
+			Callback: func(_ *Document, err error) { errorCallback(err) }}, nil
+	case "text", "":
+		return &TextRequest{To: dm.Recipient, Text: dm.Message, Options: dm.Options, Callback: callback}, nil
+	case "action":
+		return &ChatActionRequest{To: dm.Recipient, Action: dm.Action, Callback: errorCallback}, nil
+	}
+	return nil, fmt.Errorf("telebot: unknown deferred message type '%s'", dm.MsgType)
+}
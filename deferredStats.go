@@ -0,0 +1,218 @@
+package telebot
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCancelled передается в Callback сообщений, удаленных из очереди CancelChat
+// или отменой рассылки
+var ErrCancelled = errors.New("telebot: deferred message cancelled")
+
+// За сколько последних секунд считается скорость отправки
+const sendRateWindow = 60
+
+// QueueStats - состояние очереди отложенных сообщений.
+type QueueStats struct {
+	// Количество сообщений и чатов в очереди
+	Depth int
+	Chats int
+	// Время постановки в очередь самого старого сообщения, нулевое для пустой очереди
+	Oldest time.Time
+	// Отправлено сообщений в секунду за последнюю минуту
+	SendRate float64
+	// Всего отправлено и окончательно не отправлено с момента создания очереди
+	Sent   uint64
+	Failed uint64
+	// Количество повторов после временных ошибок
+	Retried uint64
+	// Ошибки отправки, включая повторенные, по итогам ClassifyError
+	Errors map[Outcome]uint64
+}
+
+// ChatQueueStats - сообщения одного чата в очереди.
+type ChatQueueStats struct {
+	Depth  int
+	Oldest time.Time
+}
+
+// sendStats - счетчики отправки, защищены DeferredSender.mu.
+type sendStats struct {
+	sent    uint64
+	failed  uint64
+	retried uint64
+	errors  map[Outcome]uint64
+
+	// Отправки по секундам за последние sendRateWindow секунд
+	window [sendRateWindow]uint64
+	second int64
+	// Время первой отправки, пока окно еще не заполнено
+	started time.Time
+}
+
+func (st *sendStats) record(err error, retried bool, now time.Time) {
+	if err != nil {
+		if st.errors == nil {
+			st.errors = make(map[Outcome]uint64)
+		}
+		st.errors[ClassifyError(err)]++
+	}
+	switch {
+	case retried:
+		st.retried++
+	case err != nil:
+		st.failed++
+	default:
+		st.sent++
+		st.advance(now)
+		st.window[st.second%sendRateWindow]++
+	}
+}
+
+// advance сдвигает окно до текущей секунды, обнуляя прошедшие.
+func (st *sendStats) advance(now time.Time) {
+	if st.started.IsZero() {
+		st.started = now
+		st.second = now.Unix()
+	}
+	second := now.Unix()
+	for s := st.second + 1; s <= second && s <= st.second+sendRateWindow; s++ {
+		st.window[s%sendRateWindow] = 0
+	}
+	if second > st.second {
+		st.second = second
+	}
+}
+
+func (st *sendStats) rate(now time.Time) float64 {
+	if st.started.IsZero() {
+		return 0
+	}
+	st.advance(now)
+
+	var total uint64
+	for _, n := range st.window {
+		total += n
+	}
+	// Пока окно не заполнено, делим на прошедшее время
+	seconds := now.Sub(st.started).Seconds()
+	if seconds > sendRateWindow {
+		seconds = sendRateWindow
+	}
+	if seconds < 1 {
+		seconds = 1
+	}
+	return float64(total) / seconds
+}
+
+// Stats возвращает состояние очереди. Время работы пропорционально
+// количеству чатов в очереди.
+func (s *DeferredSender) Stats() QueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := QueueStats{
+		Depth:    s.size,
+		SendRate: s.stats.rate(time.Now()),
+		Sent:     s.stats.sent,
+		Failed:   s.stats.failed,
+		Retried:  s.stats.retried,
+		Errors:   make(map[Outcome]uint64, len(s.stats.errors)),
+	}
+	for outcome, n := range s.stats.errors {
+		stats.Errors[outcome] = n
+	}
+
+	chats := make(map[string]bool)
+	for _, lane := range s.lanes {
+		for chatId, cq := range lane.chats {
+			chats[chatId] = true
+			if oldest := cq.oldest(); stats.Oldest.IsZero() || oldest.Before(stats.Oldest) {
+				stats.Oldest = oldest
+			}
+		}
+	}
+	stats.Chats = len(chats)
+	return stats
+}
+
+// ChatStats возвращает количество сообщений чата в очереди по всем приоритетам.
+func (s *DeferredSender) ChatStats(r Recipient) ChatQueueStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats ChatQueueStats
+	chatId := r.Destination()
+	for _, lane := range s.lanes {
+		cq, ok := lane.chats[chatId]
+		if !ok {
+			continue
+		}
+		stats.Depth += len(cq.messages)
+		if oldest := cq.oldest(); stats.Oldest.IsZero() || oldest.Before(stats.Oldest) {
+			stats.Oldest = oldest
+		}
+	}
+	return stats
+}
+
+// CancelChat удаляет из очереди все сообщения чата, например когда
+// пользователь отписался, и возвращает их количество. Callback сообщений
+// получает ErrCancelled.
+func (s *DeferredSender) CancelChat(r Recipient) int {
+	chatId := r.Destination()
+
+	s.mu.Lock()
+	var cancelled []DeferredMessage
+	for _, lane := range s.lanes {
+		cancelled = append(cancelled, lane.remove(chatId)...)
+	}
+	s.size -= len(cancelled)
+	s.mu.Unlock()
+
+	for _, dm := range cancelled {
+		s.ack(dm)
+		dm.Request.Done(ErrCancelled)
+	}
+	return len(cancelled)
+}
+
+// cancelRequests удаляет из очереди сообщения, запросы которых подходят
+// под match, и возвращает их количество. Callback сообщений получает
+// ErrCancelled.
+func (s *DeferredSender) cancelRequests(match func(Request) bool) int {
+	s.mu.Lock()
+	var cancelled []DeferredMessage
+	for _, lane := range s.lanes {
+		for _, cq := range lane.chats {
+			for i := len(cq.messages) - 1; i >= 0; i-- {
+				if match(cq.messages[i].Request) {
+					cancelled = append(cancelled, cq.messages[i])
+					lane.removeAt(cq, i)
+				}
+			}
+		}
+	}
+	s.size -= len(cancelled)
+	s.mu.Unlock()
+
+	for _, dm := range cancelled {
+		s.ack(dm)
+		dm.Request.Done(ErrCancelled)
+	}
+	return len(cancelled)
+}
+
+// oldest возвращает время постановки в очередь самого старого сообщения
+// чата. Первое сообщение не обязательно самое старое: замененное по
+// ReplaceKey сохраняет место в очереди, а повторяемое встает в начало.
+func (cq *chatQueue) oldest() time.Time {
+	oldest := cq.messages[0].enqueuedAt
+	for _, dm := range cq.messages[1:] {
+		if dm.enqueuedAt.Before(oldest) {
+			oldest = dm.enqueuedAt
+		}
+	}
+	return oldest
+}
@@ -0,0 +1,305 @@
+package telebot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DeferredStore - долговременное хранилище очереди отложенных сообщений.
+// Сообщение сохраняется при постановке в очередь и подтверждается (Ack)
+// после успешной отправки, поэтому после перезапуска неподтвержденные
+// сообщения будут отправлены снова. Методы вызываются из разных горутин
+// без блокировки очереди.
+type DeferredStore interface {
+	// Append сохраняет сообщение и присваивает ему ID.
+	Append(m *StoredMessage) error
+	// Ack удаляет сообщение из хранилища.
+	Ack(id uint64) error
+	// Pending возвращает неподтвержденные сообщения в порядке сохранения.
+	Pending() ([]StoredMessage, error)
+}
+
+// StoredMessage - сериализуемое представление DeferredMessage с запросом,
+// реализующим StorableRequest. Callback не сохраняется.
+type StoredMessage struct {
+	ID        uint64          `json:"id"`
+	Recipient string          `json:"recipient"`
+	ChatType  string          `json:"chat_type"`
+	Priority  Priority        `json:"priority,omitempty"`
+	Retry     *RetryPolicy    `json:"retry,omitempty"`
+	Enqueued  time.Time       `json:"enqueued"`
+	Replace   string          `json:"replace,omitempty"`
+	Batch     string          `json:"batch,omitempty"`
+	Kind      string          `json:"kind"`
+	Request   json.RawMessage `json:"request"`
+}
+
+// StoredFile - ссылка на файл: file_id на серверах Telegram, URL или
+// путь к локальному файлу.
+type StoredFile struct {
+	FileID  string `json:"file_id,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Url     string `json:"url,omitempty"`
+	Caption string `json:"caption,omitempty"`
+}
+
+// newStoredMessage возвращает nil, если запрос нельзя сохранить.
+func newStoredMessage(dm *DeferredMessage) (*StoredMessage, error) {
+	request, ok := dm.Request.(StorableRequest)
+	if !ok {
+		return nil, nil
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return &StoredMessage{
+		Recipient: dm.Recipient.Destination(),
+		ChatType:  chatType(dm.Recipient),
+		Priority:  dm.Priority,
+		Retry:     dm.Retry,
+		Enqueued:  dm.enqueuedAt,
+		Replace:   dm.ReplaceKey,
+		Batch:     dm.BatchKey,
+		Kind:      request.Kind(),
+		Request:   data,
+	}, nil
+}
+
+// deferredMessage восстанавливает сообщение. Возвращает ошибку, если
+// локальный файл, который нужно загрузить, больше не существует.
+func (sm StoredMessage) deferredMessage() (DeferredMessage, error) {
+	recipient, err := storedRecipient(sm.Recipient, sm.ChatType)
+	if err != nil {
+		return DeferredMessage{}, err
+	}
+
+	request, err := newRequest(sm.Kind)
+	if err != nil {
+		return DeferredMessage{}, err
+	}
+	if err := json.Unmarshal(sm.Request, request); err != nil {
+		return DeferredMessage{}, err
+	}
+	request.SetChat(recipient)
+
+	return DeferredMessage{
+		Request:    request,
+		Recipient:  recipient,
+		Priority:   sm.Priority,
+		Retry:      sm.Retry,
+		ReplaceKey: sm.Replace,
+		BatchKey:   sm.Batch,
+		storeID:    sm.ID,
+		enqueuedAt: sm.Enqueued,
+	}, nil
+}
+
+func (f *StoredFile) file() File {
+	return File{FileID: f.FileID, filename: f.Path}
+}
+
+// check проверяет, что локальный файл для загрузки существует.
+func (f *StoredFile) check() error {
+	if f == nil || f.FileID != "" || f.Url != "" {
+		return nil
+	}
+	if _, err := os.Stat(f.Path); err != nil {
+		return fmt.Errorf("telebot: '%s' does not exist", f.Path)
+	}
+	return nil
+}
+
+// storedRecipient восстанавливает получателя по Destination и типу чата.
+func storedRecipient(destination, chatType string) (Recipient, error) {
+	if strings.HasPrefix(destination, "@") {
+		return Chat{Type: "channel", Username: destination[1:]}, nil
+	}
+	id, err := strconv.ParseInt(destination, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("telebot: bad stored recipient '%s'", destination)
+	}
+	return Chat{ID: id, Type: chatType}, nil
+}
+
+// Сколько подтверждений накапливается в журнале до его перезаписи
+const fileStoreCompactAfter = 10000
+
+// FileDeferredStore хранит очередь в журнале: каждая строка файла - JSON
+// с добавленным сообщением или подтверждением. При открытии и по мере
+// накопления подтверждений журнал перезаписывается только с
+// неподтвержденными сообщениями.
+type FileDeferredStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	nextID  uint64
+	pending map[uint64]StoredMessage
+	acked   int
+}
+
+type fileStoreEntry struct {
+	Add *StoredMessage `json:"add,omitempty"`
+	Ack uint64         `json:"ack,omitempty"`
+}
+
+// OpenFileDeferredStore открывает журнал, создавая файл при необходимости.
+func OpenFileDeferredStore(path string) (*FileDeferredStore, error) {
+	s := &FileDeferredStore{
+		path:    path,
+		nextID:  1,
+		pending: make(map[uint64]StoredMessage),
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry fileStoreEntry
+			// Недописанная при падении строка пропускается
+			if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+				continue
+			}
+			if entry.Add != nil {
+				s.pending[entry.Add.ID] = *entry.Add
+				if entry.Add.ID >= s.nextID {
+					s.nextID = entry.Add.ID + 1
+				}
+			}
+			if entry.Ack != 0 {
+				delete(s.pending, entry.Ack)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileDeferredStore) Append(m *StoredMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m.ID = s.nextID
+	if err := s.write(fileStoreEntry{Add: m}); err != nil {
+		return err
+	}
+	// Сообщение должно пережить падение процесса сразу после Append
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.nextID++
+	s.pending[m.ID] = *m
+	return nil
+}
+
+func (s *FileDeferredStore) Ack(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pending[id]; !ok {
+		return nil
+	}
+	if err := s.write(fileStoreEntry{Ack: id}); err != nil {
+		return err
+	}
+	delete(s.pending, id)
+	s.acked++
+
+	if s.acked >= fileStoreCompactAfter && s.acked > len(s.pending) {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *FileDeferredStore) Pending() ([]StoredMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted(), nil
+}
+
+// Close закрывает файл журнала.
+func (s *FileDeferredStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileDeferredStore) sorted() []StoredMessage {
+	messages := make([]StoredMessage, 0, len(s.pending))
+	for _, m := range s.pending {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].ID < messages[j].ID
+	})
+	return messages
+}
+
+func (s *FileDeferredStore) write(entry fileStoreEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// compact перезаписывает журнал только с неподтвержденными сообщениями.
+func (s *FileDeferredStore) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, m := range s.sorted() {
+		m := m
+		line, err := json.Marshal(fileStoreEntry{Add: &m})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	s.acked = 0
+	return err
+}
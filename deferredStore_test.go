@@ -0,0 +1,136 @@
+package telebot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileDeferredStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.log")
+
+	store, err := OpenFileDeferredStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewDeferredSender(&Bot{}, 0)
+	s.SetStore(store)
+
+	s.Enqueue(&DeferredMessage{Recipient: User{ID: 1}, MsgType: "text", Message: "first"})
+	s.Enqueue(&DeferredMessage{Recipient: Chat{ID: -5, Type: "group"}, MsgType: "text", Message: "second"})
+	s.Enqueue(&DeferredMessage{Recipient: User{ID: 1}, MsgType: "doc",
+		Doc: &Document{File: File{filename: filepath.Join(dir, "missing.pdf")}}})
+
+	s.limiter = NewRateLimiter(RateLimits{})
+	for {
+		dm, ok := s.next()
+		if !ok {
+			break
+		}
+		if text, isText := dm.Request.(*TextRequest); isText && text.Text == "first" {
+			s.ack(dm)
+		}
+	}
+	store.Close()
+
+	store, err = OpenFileDeferredStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	restored := NewDeferredSender(&Bot{}, 0)
+	n, err := restored.SetStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatal("Expected one restored message, got", n)
+	}
+
+	restored.limiter = NewRateLimiter(RateLimits{})
+	dm, _ := restored.next()
+	text, ok := dm.Request.(*TextRequest)
+	if !ok || text.Text != "second" || chatType(text.To) != "group" || text.To.Destination() != "-5" {
+		t.Fatal("Message is not restored properly:", dm)
+	}
+	if pending, _ := store.Pending(); len(pending) != 1 {
+		t.Fatal("Messages with missing files must be dropped from the store.")
+	}
+}
+
+func TestFileDeferredStoreFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "queue.log")
+
+	store, err := OpenFileDeferredStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewDeferredSender(&Bot{}, 0)
+	s.SetStore(store)
+	s.Enqueue(&DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "blocked"}})
+	s.maxSize = 1
+	if err := s.Enqueue(&DeferredMessage{Request: &TextRequest{To: User{ID: 2}, Text: "rejected"}}); err != ErrQueueFull {
+		t.Fatal("Expected ErrQueueFull, got", err)
+	}
+	if pending, _ := store.Pending(); len(pending) != 1 {
+		t.Fatal("Rejected message must be removed from the store:", pending)
+	}
+
+	// Без DeadLetterStore окончательно неотправленное сообщение тоже
+	// удаляется из хранилища
+	s.limiter = NewRateLimiter(RateLimits{})
+	dm, _ := s.next()
+	s.deadLetter(dm, &APIError{Code: 403, Description: "Forbidden: bot was blocked by the user"})
+	store.Close()
+
+	store, err = OpenFileDeferredStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	restored := NewDeferredSender(&Bot{}, 0)
+	if n, err := restored.SetStore(store); err != nil || n != 0 {
+		t.Fatal("Failed message must not be restored:", n, err)
+	}
+}
+
+func TestStoredFileRequests(t *testing.T) {
+	if _, err := json.Marshal(&AudioRequest{To: User{ID: 1}}); err == nil {
+		t.Fatal("Request without a file must not be stored.")
+	}
+
+	video := &Video{Audio: Audio{File: File{FileID: "BAAD", FileSize: 100}, Duration: 15, Mime: "video/mp4"},
+		Width: 640, Height: 360, Caption: "clip"}
+	data, err := json.Marshal(&VideoRequest{To: User{ID: 1}, Video: video})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var restored VideoRequest
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	if *restored.Video != *video {
+		t.Fatalf("Video metadata must be kept: %+v", restored.Video)
+	}
+
+	audio := &Audio{File: File{FileID: "CQAD"}, Duration: 180, Mime: "audio/mpeg"}
+	data, _ = json.Marshal(&AudioRequest{To: User{ID: 1}, Audio: audio})
+	var restoredAudio AudioRequest
+	if err := json.Unmarshal(data, &restoredAudio); err != nil || *restoredAudio.Audio != *audio {
+		t.Fatalf("Audio metadata must be kept: %+v %v", restoredAudio.Audio, err)
+	}
+}
@@ -1,19 +1,51 @@
 package telebot
 
 import (
+	"context"
+	"log"
+	"sync"
 	"time"
-	"reflect"
+
+	"github.com/pkg/errors"
 )
 
 // источник https://habrahabr.ru/post/317666/
 
-// Мап каналов для сообщений, где ключом является id пользователя
-var deferredMessages = make(map[string]chan DeferredMessage)
-// Здесь будем хранить время последней отправки сообщения для каждого пользователя
-var lastMessageTimes = make(map[string]int64)
+// Размер очереди отложенных сообщений по умолчанию (суммарно по всем чатам)
+const DefaultDeferredQueueSize = 100000
+
+// Сколько сообщений подряд можно отправить из более приоритетных очередей,
+// пока готовое сообщение с низким приоритетом ждет
+const DefaultStarvationLimit = 10
+
+// ErrQueueFull возвращается, если очередь отложенных сообщений заполнена
+var ErrQueueFull = errors.New("telebot: deferred queue is full")
+
+// ErrSuperseded передается в Callback сообщения, замененного в очереди
+// более новым с тем же ReplaceKey
+var ErrSuperseded = errors.New("telebot: deferred message superseded")
+
+// ErrSenderStopped возвращается при постановке в очередь после вызова Stop
+var ErrSenderStopped = errors.New("telebot: deferred sender is stopped")
 
-// callback будем вызывать для обработки ошибок при обращении к API
+// Priority - приоритет отложенного сообщения. Сообщения с большим
+// приоритетом отправляются раньше.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1 // рассылки
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+	PriorityUrgent Priority = 2 // коды подтверждения, платежи
+)
+
+// DeferredMessage - сообщение в очереди. Запрос задается полем Request,
+// результат получает Callback самого запроса. Устаревший способ - поля
+// MsgType ("text", "photo", "sticker", "doc", "action") и Callback.
 type DeferredMessage struct {
+	Request Request
+
+	// Recipient можно не задавать, если задан Request.
 	Recipient Recipient
 	MsgType   string
 	Message   string
@@ -22,78 +54,579 @@ type DeferredMessage struct {
 	Doc       *Document
 	Action    string
 	Options   *SendOptions
-	Callback  func(*MsgResult, error)
+	Priority  Priority
+	// Политика повторов при временных ошибках, nil - политика очереди
+	Retry *RetryPolicy
+	// Новое сообщение с тем же ключом заменяет неотправленное в том же чате,
+	// например обновление статуса
+	ReplaceKey string
+	// Текстовые сообщения чата с одинаковым ключом объединяются в одно,
+	// если включен SetBatching
+	BatchKey string
+
+	// callback будем вызывать для обработки ошибок при обращении к API
+	Callback func(*MsgResult, error)
+
+	// ID сообщения в DeferredStore
+	storeID uint64
+	// Количество неудачных попыток и время следующей
+	attempts  int
+	notBefore time.Time
+	// Время постановки в очередь
+	enqueuedAt time.Time
 }
 
-// Метод для отправки отложенного сообщения
-func SendMsgDeferred(dm *DeferredMessage) {
+// DeferredSender - очередь отложенных сообщений бота. Отправляет сообщения
+// с заданной частотой, соблюдая ограничения Telegram из Bot.Limiter.
+// Методы безопасны для вызова из разных горутин.
+type DeferredSender struct {
+	bot     *Bot
+	maxSize int
+
+	mu sync.Mutex
+	// Очереди по приоритетам, отсортированные по убыванию приоритета
+	lanes []*deferredLane
+	// Общее количество сообщений во всех очередях
+	size int
+	// Счетчик для порядка обслуживания чатов
+	seq             uint64
+	starvationLimit int
+	// Ограничитель, по которому выбираются готовые к отправке чаты
+	limiter     *RateLimiter
+	store       DeferredStore
+	retryPolicy RetryPolicy
+	deadLetters DeadLetterStore
+	stats       sendStats
+	batching    Batching
+	prefs       PreferenceStore
+
+	// Состояние цикла отправки
+	running  bool
+	stopping bool
+	// Stop забрал сообщения из очереди, возвращать в нее больше нельзя
+	stopped  bool
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+}
 
-	chatId := dm.Recipient.Destination()
-	if _, ok := deferredMessages[chatId]; !ok {
-		deferredMessages[chatId] = make(chan DeferredMessage, 1000)
+// NewDeferredSender создает очередь для бота. maxSize ограничивает общее
+// количество сообщений в очереди, 0 - DefaultDeferredQueueSize.
+func NewDeferredSender(b *Bot, maxSize int) *DeferredSender {
+	if maxSize <= 0 {
+		maxSize = DefaultDeferredQueueSize
 	}
+	return &DeferredSender{
+		bot:             b,
+		maxSize:         maxSize,
+		starvationLimit: DefaultStarvationLimit,
+		retryPolicy:     DefaultRetryPolicy,
+	}
+}
 
-	deferredMessages[chatId] <- *dm
+// SetStarvationLimit задает, сколько сообщений подряд могут обойти готовое
+// сообщение с меньшим приоритетом. 0 отключает защиту от голодания.
+func (s *DeferredSender) SetStarvationLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.starvationLimit = n
 }
 
+// Deferred возвращает очередь отложенных сообщений бота, создавая ее при
+// первом обращении.
+func (b *Bot) Deferred() *DeferredSender {
+	b.deferredMu.Lock()
+	defer b.deferredMu.Unlock()
+	if b.deferred == nil {
+		b.deferred = NewDeferredSender(b, 0)
+	}
+	return b.deferred
+}
+
+// Метод для отправки отложенного сообщения
+func (b *Bot) SendMsgDeferred(dm *DeferredMessage) error {
+	return b.Deferred().Enqueue(dm)
+}
+
+// SendDeferredMessages отправляет сообщения из очереди бота, не более
+// msgInSec в секунду. Блокирует вызывающую горутину.
 func (b *Bot) SendDeferredMessages(msgInSec int) {
+	b.Deferred().Run(msgInSec)
+}
+
+// SetStore подключает долговременное хранилище и восстанавливает из него
+// неотправленные сообщения. Вызывается до Run. Сообщения, локальные файлы
+// которых больше не существуют, удаляются из хранилища. Сообщение, отправка
+// которого окончательно завершилась ошибкой, удаляется из хранилища и
+// переносится в DeadLetterStore, если он подключен; после перезапуска оно
+// не отправляется повторно.
+func (s *DeferredSender) SetStore(store DeferredStore) (restored int, err error) {
+	pending, err := store.Pending()
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.store = store
+	for _, sm := range pending {
+		dm, err := sm.deferredMessage()
+		if err != nil {
+			log.Println("telebot: dropping stored deferred message:", err)
+			store.Ack(sm.ID)
+			continue
+		}
+		if dm.enqueuedAt.IsZero() {
+			dm.enqueuedAt = time.Now()
+		}
+
+		s.lane(dm.Priority).push(dm, time.Now(), s.nextSeq())
+		s.size++
+		restored++
+	}
+	return restored, nil
+}
+
+// Enqueue ставит сообщение в очередь. Не блокируется: если очередь
+// заполнена, возвращает ErrQueueFull.
+//
+// Если в очереди чата уже есть неотправленное сообщение с тем же
+// ReplaceKey, новое сообщение занимает его место, а Callback старого
+// получает ErrSuperseded. Действие в чате (ChatActionRequest) без
+// ReplaceKey заменяет только действие, стоящее последним в очереди чата:
+// действие перед другим сообщением должно остаться на своем месте.
+func (s *DeferredSender) Enqueue(dm *DeferredMessage) error {
+	request, err := dm.request()
+	if err != nil {
+		return err
+	}
+	queued := *dm
+	queued.Request = request
+	queued.enqueuedAt = time.Now()
+	if queued.Recipient == nil {
+		queued.Recipient = request.Chat()
+	}
+
+	// Запись в хранилище может ждать fsync, поэтому идет без блокировки
+	if err := s.persist(&queued); err != nil {
+		return err
+	}
+	superseded, err := s.enqueue(queued)
+	if err != nil {
+		s.ack(queued)
+		return err
+	}
+	if superseded != nil {
+		s.ack(*superseded)
+		superseded.Request.Done(ErrSuperseded)
+	}
+	return nil
+}
+
+func (s *DeferredSender) enqueue(queued DeferredMessage) (*DeferredMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopping {
+		return nil, ErrSenderStopped
+	}
+	if _, ok := queued.batchText(); ok && s.batching.Window > 0 {
+		queued.notBefore = queued.enqueuedAt.Add(s.batching.Window)
+	}
+	lane, cq, i := s.findReplaced(&queued)
+	if cq == nil && s.size >= s.maxSize {
+		return nil, ErrQueueFull
+	}
+
+	if cq == nil {
+		s.lane(queued.Priority).push(queued, time.Now(), s.nextSeq())
+		s.size++
+		return nil, nil
+	}
+
+	superseded := cq.messages[i]
+	if lane.priority == queued.Priority {
+		cq.messages[i] = queued
+	} else {
+		lane.removeAt(cq, i)
+		s.lane(queued.Priority).push(queued, time.Now(), s.nextSeq())
+	}
+	return &superseded, nil
+}
+
+// persist сохраняет сообщение в хранилище, если оно подключено.
+func (s *DeferredSender) persist(queued *DeferredMessage) error {
+	s.mu.Lock()
+	store, stopping := s.store, s.stopping
+	s.mu.Unlock()
+
+	if stopping {
+		return ErrSenderStopped
+	}
+	if store == nil {
+		return nil
+	}
+	sm, err := newStoredMessage(queued)
+	if err != nil {
+		return err
+	}
+	// Запросы, которые нельзя сохранить, хранятся только в памяти
+	if sm == nil {
+		return nil
+	}
+	if err := store.Append(sm); err != nil {
+		return err
+	}
+	queued.storeID = sm.ID
+	return nil
+}
+
+// findReplaced ищет в очередях чата сообщение, которое заменяет queued.
+func (s *DeferredSender) findReplaced(queued *DeferredMessage) (*deferredLane, *chatQueue, int) {
+	chatId := queued.Recipient.Destination()
+	if queued.isAction() {
+		for _, lane := range s.lanes {
+			if lane.priority != queued.Priority {
+				continue
+			}
+			if cq, ok := lane.chats[chatId]; ok && cq.messages[len(cq.messages)-1].isAction() {
+				return lane, cq, len(cq.messages) - 1
+			}
+		}
+		return nil, nil, 0
+	}
+
+	key := queued.ReplaceKey
+	if key == "" {
+		return nil, nil, 0
+	}
+	for _, lane := range s.lanes {
+		cq, ok := lane.chats[chatId]
+		if !ok {
+			continue
+		}
+		for i := range cq.messages {
+			if cq.messages[i].ReplaceKey == key {
+				return lane, cq, i
+			}
+		}
+	}
+	return nil, nil, 0
+}
+
+// isAction говорит, что это действие в чате без ReplaceKey.
+func (dm *DeferredMessage) isAction() bool {
+	_, ok := dm.Request.(*ChatActionRequest)
+	return ok && dm.ReplaceKey == ""
+}
+
+// Len возвращает общее количество сообщений в очереди.
+func (s *DeferredSender) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// lane возвращает очередь приоритета, создавая ее при необходимости.
+func (s *DeferredSender) lane(priority Priority) *deferredLane {
+	i := 0
+	for ; i < len(s.lanes); i++ {
+		if s.lanes[i].priority == priority {
+			return s.lanes[i]
+		}
+		if s.lanes[i].priority < priority {
+			break
+		}
+	}
+
+	lane := newDeferredLane(priority)
+	s.lanes = append(s.lanes, nil)
+	copy(s.lanes[i+1:], s.lanes[i:])
+	s.lanes[i] = lane
+	return lane
+}
+
+// Run отправляет сообщения из очереди, не более msgInSec в секунду.
+// Блокируется до вызова Stop. Повторный вызов во время работы ничего не делает.
+func (s *DeferredSender) Run(msgInSec int) {
 	// Создаем тикер с заданной периодичностью сообщений в секунду
 	if msgInSec == 0 {
 		msgInSec = 30 // дефолтная периодичность 1/30 секунд
 	}
-	timer := time.NewTicker(time.Second/ time.Duration(msgInSec))
 
-	for range timer.C {
-		// Формируем массив SelectCase'ов из каналов, пользователи которых готовы получить следующее сообщение
-		cases := []reflect.SelectCase{}
-		for userId, ch := range deferredMessages {
-			if userCanReceiveMessage(userId) && len(ch) > 0 {
-				// Формирование case
-				cs := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)}
-				cases = append(cases, cs)
+	// Если у бота нет ограничителя, методы Send* не расходуют токены,
+	// поэтому очередь ведет собственный и расходует их сама.
+	shared := s.bot.Limiter != nil
+	s.mu.Lock()
+	if s.running || s.stopping {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.quit = make(chan struct{})
+	s.done = make(chan struct{})
+	quit, done := s.quit, s.done
+	if shared {
+		s.limiter = s.bot.Limiter
+	} else if s.limiter == nil {
+		s.limiter = NewRateLimiter(DefaultRateLimits)
+	}
+	s.mu.Unlock()
+
+	timer := time.NewTicker(time.Second / time.Duration(msgInSec))
+	defer func() {
+		timer.Stop()
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+		close(done)
+	}()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-timer.C:
+		}
+
+		dm, ok := s.next()
+		if !ok {
+			if s.drained() {
+				return
 			}
+			continue
+		}
+		if s.quiet(&dm, time.Now()) {
+			continue
+		}
+		if !shared {
+			s.limiter.Allow(dm.Recipient)
 		}
 
-		if len(cases) > 0 {
-			// Достаем одно сообщение из всех каналов
-			_, value, ok := reflect.Select(cases)
+		s.send(dm)
+	}
+}
 
-			if ok {
-				dm := value.Interface().(DeferredMessage)
-				// Выполняем запрос к API
+// send выполняет запрос к API. При временной ошибке сообщение возвращается
+// в очередь, иначе результат передается в Callback.
+func (s *DeferredSender) send(dm DeferredMessage) {
+	err := dm.Request.Send(s.bot)
+	retried := err != nil && s.retry(&dm, err)
 
-				result, err := sendMsg(b, dm)
-				if dm.Callback != nil {
-					dm.Callback(result, err)
-				}
-				// Записываем пользователю время последней отправки сообщения.
-				lastMessageTimes[dm.Recipient.Destination()] = time.Now().UnixNano()
-			}
+	s.mu.Lock()
+	s.stats.record(err, retried, time.Now())
+	s.mu.Unlock()
+	if retried {
+		return
+	}
+
+	if err == nil {
+		s.ack(dm)
+	} else {
+		s.deadLetter(dm, err)
+	}
+	dm.Request.Done(err)
+}
+
+// Stop прекращает прием новых сообщений и ждет, пока очередь опустеет,
+// но не дольше дедлайна ctx. После этого цикл Run завершается.
+//
+// Возвращает сообщения, которые не успели отправить, и ctx.Err(), если
+// дедлайн истек. Stop не ждет окончания текущей отправки после дедлайна:
+// ее результат, как обычно, получит Callback, но повторить ее или отложить
+// на тихие часы очередь уже не сможет. Если подключено хранилище,
+// неотправленные сообщения остаются в нем и будут отправлены после
+// перезапуска. Stop можно вызывать из разных горутин.
+func (s *DeferredSender) Stop(ctx context.Context) ([]DeferredMessage, error) {
+	s.mu.Lock()
+	s.stopping = true
+	running, quit, done := s.running, s.quit, s.done
+	s.mu.Unlock()
+
+	if running {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			s.quitOnce.Do(func() { close(quit) })
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var undelivered []DeferredMessage
+	for _, lane := range s.lanes {
+		for chatId := range lane.chats {
+			undelivered = append(undelivered, lane.remove(chatId)...)
 		}
 	}
+	s.size = 0
+	s.stopped = true
+
+	if len(undelivered) > 0 {
+		return undelivered, ctx.Err()
+	}
+	return nil, nil
 }
 
-// Проверка может ли уже пользователь получить следующее сообщение
-func userCanReceiveMessage(userId string) bool {
-	t, ok := lastMessageTimes[userId]
+// drained говорит, что после Stop очередь опустела и Run можно завершить.
+func (s *DeferredSender) drained() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping && s.size == 0
+}
+
+// ack удаляет отправленное сообщение из хранилища.
+func (s *DeferredSender) ack(dm DeferredMessage) {
+	if batch, ok := dm.Request.(*batchRequest); ok {
+		for _, part := range batch.parts {
+			s.ack(part)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	store := s.store
+	s.mu.Unlock()
 
-	return !ok || t + int64(time.Second/2) <= time.Now().UnixNano()
+	if store == nil || dm.storeID == 0 {
+		return
+	}
+	if err := store.Ack(dm.storeID); err != nil {
+		log.Println("telebot: failed to ack deferred message:", err)
+	}
+}
+
+// retry возвращает сообщение в начало очереди его чата, если ошибку можно
+// повторить и попытки не исчерпаны. Сообщения чата после него ждут, чтобы
+// сохранить порядок. Если Stop уже забрал сообщения из очереди, Callback
+// получает ошибку, а сообщение остается в хранилище до перезапуска.
+func (s *DeferredSender) retry(dm *DeferredMessage, err error) bool {
+	s.mu.Lock()
+	policy := s.retryPolicy
+	if dm.Retry != nil {
+		policy = *dm.Retry
+	}
+	dm.attempts++
+	if !IsTransient(err) || dm.attempts >= policy.MaxAttempts {
+		s.mu.Unlock()
+		return false
+	}
+	dm.notBefore = time.Now().Add(policy.backoff(dm.attempts, err))
+	requeued := s.requeue(*dm, time.Now())
+	s.mu.Unlock()
+
+	if !requeued {
+		dm.Request.Done(err)
+	}
+	return true
+}
+
+// requeue возвращает сообщение в начало очереди его чата. Объединенное
+// сообщение возвращается по частям, чтобы каждая учитывалась в Len и
+// статистике; при следующей отправке они объединятся снова. Возвращает
+// false, если Stop уже забрал сообщения из очереди. Вызывается под s.mu.
+func (s *DeferredSender) requeue(dm DeferredMessage, now time.Time) bool {
+	if s.stopped {
+		return false
+	}
+	batch, ok := dm.Request.(*batchRequest)
+	if !ok {
+		s.lane(dm.Priority).pushFront(dm, now, s.nextSeq())
+		s.size++
+		return true
+	}
+	for i := len(batch.parts) - 1; i >= 0; i-- {
+		part := batch.parts[i]
+		part.attempts = dm.attempts
+		part.notBefore = dm.notBefore
+		s.lane(dm.Priority).pushFront(part, now, s.nextSeq())
+		s.size++
+	}
+	return true
+}
+
+// deadLetter переносит сообщение, которое не удалось отправить, в
+// DeadLetterStore и в любом случае удаляет его из DeferredStore: иначе
+// после перезапуска оно отправлялось бы снова.
+func (s *DeferredSender) deadLetter(dm DeferredMessage, err error) {
+	if batch, ok := dm.Request.(*batchRequest); ok {
+		for _, part := range batch.parts {
+			part.attempts = dm.attempts
+			s.deadLetter(part, err)
+		}
+		return
+	}
+	defer s.ack(dm)
+
+	s.mu.Lock()
+	deadLetters := s.deadLetters
+	s.mu.Unlock()
+
+	if deadLetters == nil {
+		return
+	}
+	dl, marshalErr := newDeadLetter(&dm, err, time.Now())
+	if marshalErr != nil {
+		log.Println("telebot: failed to store dead letter:", marshalErr)
+		return
+	}
+	if dl == nil {
+		return
+	}
+	if err := deadLetters.Add(dl); err != nil {
+		log.Println("telebot: failed to store dead letter:", err)
+	}
 }
 
-func sendMsg(b *Bot, dm DeferredMessage) (result *MsgResult, err error) {
-	switch dm.MsgType {
-	case "photo":
-		err = b.SendPhoto(dm.Recipient, dm.Photo, dm.Options)
-	case "sticker":
-		err = b.SendSticker(dm.Recipient, dm.Sticker, dm.Options)
-	case "doc":
-		err = b.SendDocument(dm.Recipient, dm.Doc, dm.Options)
-	case "text":
-		result, err = b.SendMessage(dm.Recipient, dm.Message, dm.Options)
-	case "action":
-		err = b.SendChatAction(dm.Recipient, dm.Action)
-	default:
-		result, err = b.SendMessage(dm.Recipient, dm.Message, nil)
+// next достает из очереди одно сообщение для чата, который готов его получить.
+// Обслуживается очередь с наибольшим приоритетом, кроме случая, когда
+// готовое сообщение меньшего приоритета пропускалось starvationLimit раз.
+// Внутри очереди чаты обслуживаются по кругу в порядке готовности.
+func (s *DeferredSender) next() (DeferredMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var (
+		ready      []*deferredLane
+		readyChats []*chatQueue
+	)
+	for _, lane := range s.lanes {
+		if cq, ok := lane.peek(s.limiter, now, s.nextSeq); ok {
+			ready = append(ready, lane)
+			readyChats = append(readyChats, cq)
+		}
+	}
+	if len(ready) == 0 {
+		return DeferredMessage{}, false
+	}
+
+	picked, pickedChat := ready[0], readyChats[0]
+	if s.starvationLimit > 0 {
+		// Из голодающих очередей выбираем самую приоритетную
+		for i, lane := range ready[1:] {
+			if lane.skipped >= s.starvationLimit {
+				picked, pickedChat = lane, readyChats[i+1]
+				break
+			}
+		}
+	}
+	for _, lane := range ready {
+		if lane == picked {
+			lane.skipped = 0
+		} else {
+			lane.skipped++
+		}
 	}
-	return
-}
\ No newline at end of file
+
+	s.size--
+	dm := picked.pop(pickedChat, now, s.nextSeq())
+	return s.batch(picked, dm), true
+}
+
+func (s *DeferredSender) nextSeq() uint64 {
+	s.seq++
+	return s.seq
+}
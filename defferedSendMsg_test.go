@@ -0,0 +1,443 @@
+package telebot
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeferredSenderQueue(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				s.Enqueue(&DeferredMessage{Recipient: User{ID: id}, MsgType: "text"})
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if s.Len() != 10 {
+		t.Fatal("Queue must be bounded, got", s.Len())
+	}
+	if err := s.Enqueue(&DeferredMessage{Recipient: User{ID: 1}}); err != ErrQueueFull {
+		t.Fatal("Full queue must reject messages, got", err)
+	}
+
+	s.limiter = NewRateLimiter(RateLimits{Private: Limit{Count: 1, Per: time.Hour}})
+	dm, ok := s.next()
+	if !ok {
+		t.Fatal("Can't get a message from the queue.")
+	}
+	s.limiter.Allow(dm.Recipient)
+
+	for {
+		next, ok := s.next()
+		if !ok {
+			break
+		}
+		if next.Recipient.Destination() == dm.Recipient.Destination() {
+			t.Fatal("Chat rate limit is not respected.")
+		}
+		s.limiter.Allow(next.Recipient)
+	}
+}
+
+func TestDeferredSenderPriority(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	s.SetStarvationLimit(3)
+
+	for i := 0; i < 10; i++ {
+		s.Enqueue(&DeferredMessage{Recipient: User{ID: 1}, Message: "news", Priority: PriorityLow})
+		s.Enqueue(&DeferredMessage{Recipient: User{ID: 2}, Message: strconv.Itoa(i)})
+	}
+	s.Enqueue(&DeferredMessage{Recipient: User{ID: 3}, Message: "otp", Priority: PriorityUrgent})
+
+	if dm, _ := s.next(); dm.Message != "otp" {
+		t.Fatal("Urgent message must go first, got", dm.Message)
+	}
+
+	var order []string
+	for i := 0; i < 8; i++ {
+		dm, _ := s.next()
+		order = append(order, dm.Message)
+	}
+	expected := "0 1 news 2 3 4 news 5"
+	if strings.Join(order, " ") != expected {
+		t.Fatal("Wrong order:", strings.Join(order, " "))
+	}
+}
+
+func TestDeferredSenderStop(t *testing.T) {
+	user := User{ID: 1}
+	b := &Bot{Limiter: NewRateLimiter(RateLimits{Private: Limit{Count: 1, Per: time.Hour}})}
+	b.Limiter.Allow(user)
+
+	s := NewDeferredSender(b, 0)
+	s.Enqueue(&DeferredMessage{Recipient: user, MsgType: "text", Message: "late"})
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(100)
+		close(stopped)
+	}()
+	for !s.isRunning() {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	undelivered, err := s.Stop(ctx)
+	if err != context.DeadlineExceeded || len(undelivered) != 1 || undelivered[0].Message != "late" {
+		t.Fatal("Stop must report undelivered messages after the deadline:", undelivered, err)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Run must exit after Stop.")
+	}
+
+	if err := s.Enqueue(&DeferredMessage{Recipient: user}); err != ErrSenderStopped {
+		t.Fatal("Stopped sender must reject messages, got", err)
+	}
+}
+
+// blockingRequest не завершает отправку, пока не закрыт release.
+type blockingRequest struct {
+	to      Recipient
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRequest) Chat() Recipient { return r.to }
+func (r *blockingRequest) Done(err error)  {}
+
+func (r *blockingRequest) Send(b *Bot) error {
+	close(r.started)
+	<-r.release
+	return nil
+}
+
+func TestDeferredSenderStopInFlight(t *testing.T) {
+	s := NewDeferredSender(&Bot{Limiter: NewRateLimiter(RateLimits{})}, 0)
+	request := &blockingRequest{to: User{ID: 1}, started: make(chan struct{}), release: make(chan struct{})}
+	defer close(request.release)
+	s.Enqueue(&DeferredMessage{Request: request})
+	s.Enqueue(&DeferredMessage{Recipient: User{ID: 2}, Message: "late"})
+	go s.Run(1000)
+	<-request.started
+
+	// Одновременные Stop не ждут зависшую отправку и не паникуют
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Stop(ctx)
+		}()
+	}
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop must return at the deadline.")
+	}
+}
+
+func TestDeferredSenderRetryAfterStop(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	s.SetRetryPolicy(RetryPolicy{MaxAttempts: 3})
+
+	var result error
+	s.Enqueue(&DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "hello",
+		Callback: func(_ *MsgResult, err error) { result = err }}})
+	dm, _ := s.next()
+	// Отправка, которую Stop не дождался, завершается уже после него
+	s.Stop(context.Background())
+
+	if !s.retry(&dm, &APIError{Code: 500}) {
+		t.Fatal("Transient error must not dead-letter the message after Stop.")
+	}
+	if s.Len() != 0 || result == nil {
+		t.Fatal("Message must not be requeued after Stop:", s.Len(), result)
+	}
+}
+
+func (s *DeferredSender) isRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running
+}
+
+func TestDeferredSenderRequests(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+
+	if err := s.Enqueue(&DeferredMessage{Recipient: User{ID: 1}, MsgType: "audio"}); err == nil {
+		t.Fatal("Unknown message types must be rejected.")
+	}
+
+	chat := Chat{ID: -10, Type: "group"}
+	s.Enqueue(&DeferredMessage{Request: &DeleteRequest{Message: Message{ID: 5, Chat: chat}}})
+	dm, ok := s.next()
+	if !ok || dm.Recipient.Destination() != "-10" {
+		t.Fatal("Request chat must be used as a recipient.")
+	}
+	if _, ok := dm.Request.(StorableRequest); !ok {
+		t.Fatal("Delete requests must be storable.")
+	}
+}
+
+func TestDeferredSenderRoundRobin(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+
+	for i := 0; i < 3; i++ {
+		for chat := 1; chat <= 3; chat++ {
+			s.Enqueue(&DeferredMessage{Recipient: User{ID: chat}, Message: strconv.Itoa(i)})
+		}
+	}
+	s.Enqueue(&DeferredMessage{Recipient: User{ID: 1}, Message: "3"})
+
+	var order []string
+	for {
+		dm, ok := s.next()
+		if !ok {
+			break
+		}
+		order = append(order, dm.Recipient.Destination()+":"+dm.Message)
+	}
+	if got := strings.Join(order, " "); got != "1:0 2:0 3:0 1:1 2:1 3:1 1:2 2:2 3:2 1:3" {
+		t.Fatal("Chats must be served round-robin, got", got)
+	}
+}
+
+// Очередь со 100 тысячами чатов: каждый отправленный чат получает новое
+// сообщение, поэтому размер очереди не меняется.
+func benchmarkQueue(limits RateLimits) (*DeferredSender, map[string]int) {
+	const chats = 100000
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(limits)
+	for i := 1; i <= chats; i++ {
+		s.Enqueue(&DeferredMessage{Recipient: User{ID: i}, MsgType: "text"})
+	}
+	return s, make(map[string]int, chats)
+}
+
+func BenchmarkDeferredSenderNext(b *testing.B) {
+	s, sent := benchmarkQueue(RateLimits{})
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dm, ok := s.next()
+		if !ok {
+			b.Fatal("Queue must not run dry.")
+		}
+		sent[dm.Recipient.Destination()]++
+		s.Enqueue(&dm)
+	}
+	b.StopTimer()
+	reportFairness(b, sent, 100000)
+}
+
+// reportFairness сообщает разницу между наибольшим и наименьшим числом
+// отправок в один чат. При обслуживании по кругу она не больше 1.
+func reportFairness(b *testing.B, sent map[string]int, chats int) {
+	min, max := 0, 0
+	if len(sent) == chats {
+		min = b.N
+	}
+	for _, n := range sent {
+		if n < min {
+			min = n
+		}
+		if n > max {
+			max = n
+		}
+	}
+	b.ReportMetric(float64(max-min), "spread")
+}
+
+func TestDeferredSenderStats(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	s.SetRetryPolicy(RetryPolicy{MaxAttempts: 1})
+
+	var cancelled int
+	for i := 0; i < 3; i++ {
+		s.Enqueue(&DeferredMessage{Request: &testRequest{to: User{ID: 1}, sent: new(int32)}})
+		s.Enqueue(&DeferredMessage{Request: &TextRequest{To: User{ID: 2},
+			Callback: func(_ *MsgResult, err error) {
+				if err == ErrCancelled {
+					cancelled++
+				}
+			}}})
+	}
+	blocked := newAPIError([]byte(`{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`))
+	s.Enqueue(&DeferredMessage{Request: &testRequest{to: User{ID: 3}, err: blocked, sent: new(int32)}})
+
+	stats := s.Stats()
+	if stats.Depth != 7 || stats.Chats != 3 || stats.Oldest.IsZero() {
+		t.Fatal("Wrong queue stats:", stats)
+	}
+	if chat := s.ChatStats(User{ID: 2}); chat.Depth != 3 || chat.Oldest.Before(stats.Oldest) {
+		t.Fatal("Wrong chat stats:", chat)
+	}
+
+	// Замененное сообщение остается первым, но становится новее следующих
+	status := User{ID: 4}
+	s.Enqueue(&DeferredMessage{Recipient: status, Message: "1%", ReplaceKey: "progress"})
+	s.Enqueue(&DeferredMessage{Recipient: status, Message: "done"})
+	time.Sleep(time.Millisecond)
+	replaced := time.Now()
+	s.Enqueue(&DeferredMessage{Recipient: status, Message: "2%", ReplaceKey: "progress"})
+	if chat := s.ChatStats(status); chat.Depth != 2 || !chat.Oldest.Before(replaced) {
+		t.Fatal("Oldest must be the earliest enqueued message:", chat)
+	}
+	s.CancelChat(status)
+
+	if n := s.CancelChat(User{ID: 2}); n != 3 || cancelled != 3 || s.Len() != 4 {
+		t.Fatal("Chat messages must be cancelled:", n, cancelled, s.Len())
+	}
+
+	for {
+		dm, ok := s.next()
+		if !ok {
+			break
+		}
+		s.send(dm)
+	}
+	stats = s.Stats()
+	if stats.Sent != 3 || stats.Failed != 1 || stats.Errors[OutcomeBlocked] != 1 || stats.SendRate != 3 {
+		t.Fatal("Wrong send stats:", stats)
+	}
+}
+
+func TestDeferredSenderCoalescing(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 4)
+	s.limiter = NewRateLimiter(RateLimits{})
+	user := User{ID: 1}
+
+	var superseded int
+	status := func(text string) *DeferredMessage {
+		return &DeferredMessage{ReplaceKey: "status", Request: &TextRequest{To: user, Text: text,
+			Callback: func(_ *MsgResult, err error) {
+				if err == ErrSuperseded {
+					superseded++
+				}
+			}}}
+	}
+
+	s.Enqueue(&DeferredMessage{Recipient: user, MsgType: "action", Action: "typing"})
+	s.Enqueue(status("10%"))
+	s.Enqueue(&DeferredMessage{Recipient: user, MsgType: "text", Message: "hello"})
+	s.Enqueue(&DeferredMessage{Recipient: user, MsgType: "action", Action: "upload_photo"})
+	if err := s.Enqueue(status("50%")); err != nil {
+		t.Fatal("Replacing message must be accepted by a full queue:", err)
+	}
+	s.Enqueue(status("90%"))
+	// Действие заменяет только действие в конце очереди чата
+	s.Enqueue(&DeferredMessage{Recipient: user, MsgType: "action", Action: "upload_document"})
+
+	if s.Len() != 4 || superseded != 2 {
+		t.Fatal("Older messages must be superseded:", s.Len(), superseded)
+	}
+
+	var order []string
+	for {
+		dm, ok := s.next()
+		if !ok {
+			break
+		}
+		switch r := dm.Request.(type) {
+		case *ChatActionRequest:
+			order = append(order, r.Action)
+		case *TextRequest:
+			order = append(order, r.Text)
+		}
+	}
+	if got := strings.Join(order, " "); got != "typing 90% hello upload_document" {
+		t.Fatal("Newer messages must take the place of superseded ones, got", got)
+	}
+}
+
+func TestDeferredSenderBatching(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	s.SetBatching(Batching{Window: 20 * time.Millisecond, Join: func(texts []string) string {
+		return strconv.Itoa(len(texts)) + " alerts: " + strings.Join(texts, ", ")
+	}})
+	user := User{ID: 1}
+
+	var results int
+	alert := func(text string) *DeferredMessage {
+		return &DeferredMessage{BatchKey: "alerts", Request: &TextRequest{To: user, Text: text,
+			Callback: func(*MsgResult, error) { results++ }}}
+	}
+	s.Enqueue(alert("cpu"))
+	s.Enqueue(alert("disk"))
+	s.Enqueue(&DeferredMessage{Recipient: user, MsgType: "text", Message: "hello"})
+	s.Enqueue(alert(strings.Repeat("x", MaxMessageLength)))
+	s.Enqueue(alert("memory"))
+
+	if _, ok := s.next(); ok {
+		t.Fatal("Batched message must wait for the window.")
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	dm, _ := s.next()
+	batch, ok := dm.Request.(*batchRequest)
+	if !ok || batch.text.Text != "2 alerts: cpu, disk" {
+		t.Fatal("Messages with the same key must be merged:", dm.Request)
+	}
+	batch.Done(nil)
+	if results != 2 {
+		t.Fatal("Every merged message must get its callback.")
+	}
+
+	var rest []string
+	for {
+		dm, ok := s.next()
+		if !ok {
+			break
+		}
+		rest = append(rest, dm.Request.(*TextRequest).Text)
+	}
+	// Сообщения не обгоняют "hello", а слишком длинные идут отдельно
+	if len(rest) != 3 || rest[0] != "hello" || len(rest[1]) != MaxMessageLength || rest[2] != "memory" {
+		t.Fatal("Only consecutive messages must be merged in order:", len(rest))
+	}
+
+	// Повторяемое объединенное сообщение возвращается в очередь по частям
+	s.Enqueue(alert("cpu"))
+	s.Enqueue(alert("disk"))
+	time.Sleep(30 * time.Millisecond)
+	dm, _ = s.next()
+	if !s.retry(&dm, &APIError{Code: 500}) {
+		t.Fatal("Transient error must be retried.")
+	}
+	if s.Len() != 2 || s.Stats().Depth != 2 {
+		t.Fatal("Retried batch must be counted per message:", s.Len(), s.Stats().Depth)
+	}
+	undelivered, _ := s.Stop(context.Background())
+	if len(undelivered) != 2 || undelivered[0].Request.(*TextRequest).Text != "cpu" || undelivered[1].attempts != 1 {
+		t.Fatal("Stop must return the merged messages:", undelivered)
+	}
+}
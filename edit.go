@@ -0,0 +1,227 @@
+package telebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Editable - сообщение, которое можно изменить: сообщение в чате или
+// сообщение, отправленное через бота в inline-режиме.
+type Editable interface {
+	// MessageSig возвращает ID сообщения и ID чата. Для inline-сообщений
+	// chatID равен 0, а messageID - это inline_message_id. Message и
+	// Callback с нулевым ID чата изменить нельзя.
+	MessageSig() (messageID string, chatID int64)
+}
+
+func (m Message) MessageSig() (string, int64) {
+	return strconv.Itoa(m.ID), m.Chat.ID
+}
+
+// MessageSig возвращает inline-сообщение, если кнопка была под ним,
+// иначе сообщение в чате.
+func (c Callback) MessageSig() (string, int64) {
+	if c.MessageID != "" {
+		return c.MessageID, 0
+	}
+	return c.Message.MessageSig()
+}
+
+// InlineMessageID - ID сообщения, отправленного через бота в inline-режиме.
+type InlineMessageID string
+
+func (id InlineMessageID) MessageSig() (string, int64) {
+	return string(id), 0
+}
+
+// inlineChat ограничивает частоту изменений inline-сообщения так же,
+// как сообщений в личном чате.
+type inlineChat string
+
+func (c inlineChat) Destination() string {
+	return string(c)
+}
+
+// editRequest - запрос изменения сообщения.
+type editRequest struct {
+	method string
+	// Получатель для ограничения частоты: чат сообщения, как при отправке
+	to     Recipient
+	params map[string]string
+	// Локальный файл и имя части формы, под которым он загружается.
+	// Имя не должно совпадать с параметрами: "media" занят описанием
+	upload     string
+	uploadName string
+}
+
+// newEditRequest заполняет параметры, которые указывают на сообщение.
+// Сообщение в чате без ID чата - ошибка: иначе его ID ушел бы в
+// inline_message_id.
+func newEditRequest(method string, e Editable) (*editRequest, error) {
+	messageID, chatID := e.MessageSig()
+
+	var chat *Chat
+	switch m := e.(type) {
+	case Message:
+		chat = &m.Chat
+	case *Message:
+		chat = &m.Chat
+	case Callback:
+		if m.MessageID == "" {
+			chat = &m.Message.Chat
+		}
+	case *Callback:
+		if m.MessageID == "" {
+			chat = &m.Message.Chat
+		}
+	}
+
+	r := &editRequest{method: method}
+	switch {
+	case chat != nil && chatID == 0:
+		return nil, fmt.Errorf("telebot: message %s has no chat id", messageID)
+	case chatID == 0:
+		r.to = inlineChat(messageID)
+		r.params = map[string]string{"inline_message_id": messageID}
+	default:
+		r.to = Chat{ID: chatID}
+		if chat != nil {
+			r.to = *chat
+		}
+		r.params = map[string]string{"chat_id": strconv.FormatInt(chatID, 10), "message_id": messageID}
+	}
+	return r, nil
+}
+
+// EditMessageText изменяет текст сообщения в чате или inline-сообщения.
+func (b *Bot) EditMessageText(e Editable, text string, options *SendOptions) error {
+	return b.edit(textEdit(e, text, options))
+}
+
+func textEdit(e Editable, text string, options *SendOptions) (*editRequest, error) {
+	r, err := newEditRequest("editMessageText", e)
+	if err != nil {
+		return nil, err
+	}
+	r.params["text"] = text
+	embedSendOptions(r.params, options)
+	return r, nil
+}
+
+// EditMessageCaption изменяет подпись к медиа.
+func (b *Bot) EditMessageCaption(e Editable, caption string, options *SendOptions) error {
+	return b.edit(captionEdit(e, caption, options))
+}
+
+func captionEdit(e Editable, caption string, options *SendOptions) (*editRequest, error) {
+	r, err := newEditRequest("editMessageCaption", e)
+	if err != nil {
+		return nil, err
+	}
+	r.params["caption"] = caption
+	embedSendOptions(r.params, options)
+	return r, nil
+}
+
+// EditMessageReplyMarkup заменяет inline-клавиатуру сообщения.
+// markup nil убирает клавиатуру.
+func (b *Bot) EditMessageReplyMarkup(e Editable, markup *ReplyMarkup) error {
+	return b.edit(markupEdit(e, markup))
+}
+
+func markupEdit(e Editable, markup *ReplyMarkup) (*editRequest, error) {
+	r, err := newEditRequest("editMessageReplyMarkup", e)
+	if err != nil {
+		return nil, err
+	}
+	if markup != nil {
+		embedSendOptions(r.params, &SendOptions{ReplyMarkup: *markup})
+	}
+	return r, nil
+}
+
+// InputMedia - новое содержимое сообщения для EditMessageMedia.
+type InputMedia struct {
+	// "photo", "video", "animation", "audio" или "document"
+	Type string
+	// Файл на серверах Telegram (FileID) или локальный файл из NewFile
+	File File
+	// Адрес файла, если File не задан
+	Url string
+
+	Caption   string
+	ParseMode ParseMode
+}
+
+// EditMessageMedia заменяет медиа в сообщении. Локальный файл загружается.
+// Из options используется только ReplyMarkup.
+func (b *Bot) EditMessageMedia(e Editable, media InputMedia, options *SendOptions) error {
+	return b.edit(mediaEdit(e, media, options))
+}
+
+func mediaEdit(e Editable, media InputMedia, options *SendOptions) (*editRequest, error) {
+	r, err := newEditRequest("editMessageMedia", e)
+	if err != nil {
+		return nil, err
+	}
+
+	value := media.Url
+	if media.File.Exists() {
+		value = media.File.FileID
+	} else if media.File.Local() != "" {
+		r.upload, r.uploadName = media.File.Local(), "file0"
+		value = "attach://" + r.uploadName
+	}
+
+	data, err := json.Marshal(struct {
+		Type      string    `json:"type"`
+		Media     string    `json:"media"`
+		Caption   string    `json:"caption,omitempty"`
+		ParseMode ParseMode `json:"parse_mode,omitempty"`
+	}{media.Type, value, media.Caption, media.ParseMode})
+	if err != nil {
+		return nil, err
+	}
+	r.params["media"] = string(data)
+
+	if options != nil {
+		embedSendOptions(r.params, &SendOptions{ReplyMarkup: options.ReplyMarkup})
+	}
+	return r, nil
+}
+
+// edit выполняет запрос изменения сообщения. Принимает результат
+// построения запроса, чтобы не проверять ошибку в каждом методе.
+func (b *Bot) edit(r *editRequest, err error) error {
+	if err != nil {
+		return err
+	}
+	b.limit(r.to)
+
+	var responseJSON []byte
+	if r.upload != "" {
+		responseJSON, err = sendFile(r.method, b.Token, r.uploadName, r.upload, r.params)
+	} else {
+		responseJSON, err = sendCommand(r.method, b.Token, r.params)
+	}
+	if err != nil {
+		return err
+	}
+
+	var responseRecieved struct {
+		Ok          bool
+		Description string
+	}
+
+	err = json.Unmarshal(responseJSON, &responseRecieved)
+	if err != nil {
+		return err
+	}
+
+	if !responseRecieved.Ok {
+		return newAPIError(responseJSON)
+	}
+
+	return nil
+}
@@ -0,0 +1,307 @@
+package telebot
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEditInterval - наименьший интервал между изменениями одного
+// сообщения по умолчанию.
+const DefaultEditInterval = time.Second
+
+// DefaultEditIdleTTL - сколько по умолчанию помнить сообщение, все
+// изменения которого отправлены.
+const DefaultEditIdleTTL = 10 * time.Minute
+
+// EditManager изменяет сообщения без лишних запросов: помнит последний
+// отправленный текст и клавиатуру каждого сообщения, пропускает изменения,
+// которые ничего не меняют, и объединяет частые изменения. Сообщение
+// изменяется не чаще раза в Interval, отправляется только последнее
+// состояние.
+//
+// Изменения отправляются асинхронно, ошибки передаются в OnError.
+// Flush отправляет отложенное изменение сразу, Forget забывает сообщение,
+// например после удаления. Сообщения, которые не менялись дольше IdleTTL
+// и все изменения которых отправлены, забываются сами.
+type EditManager struct {
+	Interval time.Duration
+	IdleTTL  time.Duration
+	OnError  func(e Editable, err error)
+
+	editText   func(e Editable, text string, options *SendOptions) error
+	editMarkup func(e Editable, markup *ReplyMarkup) error
+
+	mu        sync.Mutex
+	messages  map[string]*editState
+	lastSweep time.Time
+}
+
+// editState - желаемое и отправленное состояние сообщения.
+type editState struct {
+	editable Editable
+	// Отправки одного сообщения идут по очереди
+	sendMu sync.Mutex
+
+	text      string
+	hasText   bool
+	options   SendOptions
+	markup    ReplyMarkup
+	textSig   string
+	markupSig string
+
+	sentText   string
+	sentMarkup string
+	lastSent   time.Time
+	// Время последнего обращения через Edit, EditReplyMarkup или Remember
+	touched   time.Time
+	timer     *time.Timer
+	sending   bool
+	forgotten bool
+}
+
+// NewEditManager создает EditManager для бота. interval <= 0 означает
+// DefaultEditInterval.
+func NewEditManager(b *Bot, interval time.Duration) *EditManager {
+	if interval <= 0 {
+		interval = DefaultEditInterval
+	}
+	return &EditManager{
+		Interval:   interval,
+		IdleTTL:    DefaultEditIdleTTL,
+		editText:   b.EditMessageText,
+		editMarkup: b.EditMessageReplyMarkup,
+		messages:   make(map[string]*editState),
+	}
+}
+
+// Edit ставит изменение текста сообщения. Если текст, разметка и
+// клавиатура совпадают с отправленными, запрос не выполняется.
+func (m *EditManager) Edit(e Editable, text string, options *SendOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(e)
+	st.setText(text, options)
+	m.schedule(st)
+}
+
+// EditReplyMarkup ставит замену клавиатуры сообщения. markup nil
+// убирает клавиатуру.
+func (m *EditManager) EditReplyMarkup(e Editable, markup *ReplyMarkup) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(e)
+	st.markup = ReplyMarkup{}
+	if markup != nil {
+		st.markup = *markup
+	}
+	st.markupSig = markupSignature(st.markup)
+	m.schedule(st)
+}
+
+// Remember запоминает текущее содержимое сообщения, например сразу после
+// отправки, чтобы первое же совпадающее изменение было пропущено.
+func (m *EditManager) Remember(e Editable, text string, options *SendOptions) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(e)
+	st.setText(text, options)
+	st.sentText, st.sentMarkup = st.textSig, st.markupSig
+}
+
+// Flush сразу отправляет отложенное изменение сообщения, не дожидаясь
+// Interval, и возвращает ошибку отправки.
+func (m *EditManager) Flush(e Editable) error {
+	m.mu.Lock()
+	st, ok := m.messages[editKey(e)]
+	if ok && st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return m.flush(st, true)
+}
+
+// Forget забывает сообщение и отменяет его отложенное изменение.
+func (m *EditManager) Forget(e Editable) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := editKey(e)
+	if st, ok := m.messages[key]; ok {
+		if st.timer != nil {
+			st.timer.Stop()
+		}
+		st.forgotten = true
+		delete(m.messages, key)
+	}
+}
+
+func (m *EditManager) state(e Editable) *editState {
+	if m.messages == nil {
+		m.messages = make(map[string]*editState)
+	}
+	now := time.Now()
+	m.sweep(now)
+
+	key := editKey(e)
+	st, ok := m.messages[key]
+	if !ok {
+		st = &editState{
+			editable:   e,
+			markupSig:  markupSignature(ReplyMarkup{}),
+			sentMarkup: markupSignature(ReplyMarkup{}),
+		}
+		m.messages[key] = st
+	}
+	st.touched = now
+	return st
+}
+
+// sweep раз в IdleTTL забывает сообщения, которые не менялись дольше
+// IdleTTL и не ждут отправки: все изменения отправлены или отправка
+// завершилась ошибкой. Вызывается под m.mu.
+func (m *EditManager) sweep(now time.Time) {
+	ttl := m.IdleTTL
+	if ttl <= 0 {
+		ttl = DefaultEditIdleTTL
+	}
+	if now.Sub(m.lastSweep) < ttl {
+		return
+	}
+	m.lastSweep = now
+
+	for key, st := range m.messages {
+		if st.sending || st.timer != nil {
+			continue
+		}
+		if now.Sub(st.touched) >= ttl && now.Sub(st.lastSent) >= ttl {
+			st.forgotten = true
+			delete(m.messages, key)
+		}
+	}
+}
+
+// schedule заводит таймер отправки, если состояние изменилось и
+// отправка еще не запланирована. Вызывается под m.mu.
+func (m *EditManager) schedule(st *editState) {
+	if !st.changed() || st.timer != nil || st.forgotten {
+		return
+	}
+	delay := st.lastSent.Add(m.Interval).Sub(time.Now())
+	if delay < 0 {
+		delay = 0
+	}
+	st.timer = time.AfterFunc(delay, func() {
+		if err := m.flush(st, false); err != nil && m.OnError != nil {
+			m.OnError(st.editable, err)
+		}
+	})
+}
+
+// flush отправляет последнее состояние сообщения, если оно отличается
+// от отправленного. Без force отправка откладывается, если с прошлой
+// не прошел Interval: таймер мог быть заведен во время прошлой отправки.
+func (m *EditManager) flush(st *editState, force bool) error {
+	st.sendMu.Lock()
+	defer st.sendMu.Unlock()
+
+	m.mu.Lock()
+	st.timer = nil
+	if !force && time.Now().Before(st.lastSent.Add(m.Interval)) {
+		m.schedule(st)
+		m.mu.Unlock()
+		return nil
+	}
+	textChanged := st.hasText && st.textSig != st.sentText
+	markupChanged := st.markupSig != st.sentMarkup
+	text, options, markup := st.text, st.options, st.markup
+	textSig, markupSig := st.textSig, st.markupSig
+	if !textChanged && !markupChanged {
+		m.mu.Unlock()
+		return nil
+	}
+	st.sending = true
+	m.mu.Unlock()
+
+	var err error
+	if textChanged {
+		// editMessageText без reply_markup убирает клавиатуру
+		options.ReplyMarkup = markup
+		err = m.editText(st.editable, text, &options)
+	} else {
+		err = m.editMarkup(st.editable, &markup)
+	}
+	if isNotModified(err) {
+		err = nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st.sending = false
+	st.lastSent = time.Now()
+	if err == nil {
+		st.sentText, st.sentMarkup = textSig, markupSig
+	} else if apiErr, ok := err.(*APIError); ok && apiErr.RetryAfter > 0 {
+		// Изменение повторится после паузы, которую назвал Telegram
+		st.lastSent = st.lastSent.Add(time.Duration(apiErr.RetryAfter) * time.Second)
+		err = nil
+	} else {
+		return err
+	}
+	m.schedule(st)
+	return nil
+}
+
+func (st *editState) setText(text string, options *SendOptions) {
+	st.options = SendOptions{}
+	if options != nil {
+		st.options = *options
+	}
+	st.text, st.hasText = text, true
+	st.markup = st.options.ReplyMarkup
+	st.textSig = textSignature(text, st.options)
+	st.markupSig = markupSignature(st.markup)
+}
+
+func (st *editState) changed() bool {
+	return (st.hasText && st.textSig != st.sentText) || st.markupSig != st.sentMarkup
+}
+
+func editKey(e Editable) string {
+	messageID, chatID := e.MessageSig()
+	return strconv.FormatInt(chatID, 10) + "/" + messageID
+}
+
+// textSignature описывает то, что видит пользователь: текст и его оформление.
+func textSignature(text string, options SendOptions) string {
+	entities, _ := json.Marshal(options.Entities)
+	return strings.Join([]string{
+		text,
+		string(options.ParseMode),
+		strconv.FormatBool(options.DisableWebPagePreview),
+		string(entities),
+	}, "\x00")
+}
+
+func markupSignature(markup ReplyMarkup) string {
+	data, _ := json.Marshal(markup.InlineKeyboard)
+	return string(data)
+}
+
+// isNotModified говорит, что Telegram отклонил изменение, потому что
+// содержимое сообщения не изменилось.
+func isNotModified(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && strings.Contains(apiErr.Description, "message is not modified")
+}
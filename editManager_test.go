@@ -0,0 +1,150 @@
+package telebot
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// editRecorder записывает изменения, которые EditManager отправил в API.
+type editRecorder struct {
+	mu      sync.Mutex
+	texts   []string
+	markups int
+	times   []time.Time
+	err     error
+}
+
+func (r *editRecorder) manager(interval time.Duration) *EditManager {
+	m := NewEditManager(&Bot{}, interval)
+	m.editText = func(e Editable, text string, options *SendOptions) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.texts = append(r.texts, text)
+		r.times = append(r.times, time.Now())
+		return r.err
+	}
+	m.editMarkup = func(e Editable, markup *ReplyMarkup) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.markups++
+		r.times = append(r.times, time.Now())
+		return r.err
+	}
+	return m
+}
+
+func (r *editRecorder) sent() ([]string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.texts...), r.markups
+}
+
+func TestEditManagerCoalescing(t *testing.T) {
+	var r editRecorder
+	interval := 50 * time.Millisecond
+	m := r.manager(interval)
+	message := Message{ID: 1, Chat: Chat{ID: 10}}
+
+	m.Remember(message, "0%", nil)
+	m.Edit(message, "0%", nil)
+	time.Sleep(interval)
+	if texts, _ := r.sent(); len(texts) != 0 {
+		t.Fatal("Edit without changes must be skipped:", texts)
+	}
+
+	for i := 1; i <= 100; i++ {
+		m.Edit(message, string(rune('0'+i%10))+"%", nil)
+		if i%25 == 0 {
+			time.Sleep(interval / 2)
+		}
+	}
+	m.Edit(message, "done", nil)
+
+	var texts []string
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(interval / 5) {
+		if texts, _ = r.sent(); len(texts) > 0 && texts[len(texts)-1] == "done" {
+			break
+		}
+	}
+	if len(texts) == 0 || texts[len(texts)-1] != "done" {
+		t.Fatalf("Expected edits ending with the latest text, got %q", texts)
+	}
+	r.mu.Lock()
+	for i := 1; i < len(r.times); i++ {
+		if gap := r.times[i].Sub(r.times[i-1]); gap < interval {
+			t.Errorf("Edits must be at least %s apart, got %s", interval, gap)
+		}
+	}
+	r.mu.Unlock()
+
+	// Изменение только клавиатуры идет через editMessageReplyMarkup
+	keyboard := ReplyMarkup{InlineKeyboard: [][]KeyboardButton{{{Text: "Stop", Data: "stop"}}}}
+	m.EditReplyMarkup(message, &keyboard)
+	if err := m.Flush(message); err != nil {
+		t.Fatal(err)
+	}
+	m.Edit(message, "done", &SendOptions{ReplyMarkup: keyboard})
+	m.Flush(message)
+	if after, markups := r.sent(); markups != 1 || len(after) != len(texts) {
+		t.Fatalf("Expected one markup edit and no text edits, got %d and %q", markups, after[len(texts):])
+	}
+}
+
+func TestEditManagerErrors(t *testing.T) {
+	r := editRecorder{err: &APIError{Code: 400, Description: "Bad Request: message is not modified"}}
+	m := r.manager(time.Millisecond)
+	inline := InlineMessageID("AAQ")
+
+	m.Edit(inline, "a", nil)
+	if err := m.Flush(inline); err != nil {
+		t.Fatal("Not modified must count as success:", err)
+	}
+	m.Edit(inline, "a", nil)
+	m.Flush(inline)
+	if texts, _ := r.sent(); len(texts) != 1 {
+		t.Fatal("Not modified text must be remembered:", texts)
+	}
+
+	r.err = &APIError{Code: 400, Description: "Bad Request: message to edit not found"}
+	failed := make(chan error, 1)
+	m.OnError = func(e Editable, err error) { failed <- err }
+	m.Edit(inline, "b", nil)
+	select {
+	case err := <-failed:
+		if err != r.err {
+			t.Fatal("Unexpected error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnError is not called")
+	}
+
+	m.Forget(inline)
+	if _, ok := m.messages[editKey(inline)]; ok {
+		t.Fatal("Forgotten message must be removed")
+	}
+}
+
+func TestEditManagerEviction(t *testing.T) {
+	var r editRecorder
+	m := r.manager(time.Millisecond)
+	m.IdleTTL = 20 * time.Millisecond
+
+	remembered := Message{ID: 1, Chat: Chat{ID: 10}}
+	sent := Message{ID: 2, Chat: Chat{ID: 10}}
+	m.Remember(remembered, "a", nil)
+	m.Edit(sent, "b", nil)
+	if err := m.Flush(sent); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(2 * m.IdleTTL)
+	active := Message{ID: 3, Chat: Chat{ID: 10}}
+	m.Remember(active, "c", nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) != 1 || m.messages[editKey(active)] == nil {
+		t.Fatal("Idle messages must be forgotten:", len(m.messages))
+	}
+}
@@ -0,0 +1,88 @@
+package telebot
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEditParams(t *testing.T) {
+	channel := Chat{ID: -1001, Type: "channel", Username: "news"}
+	message := Message{ID: 5, Chat: channel}
+
+	cases := []struct {
+		editable Editable
+		params   map[string]string
+		to       string
+	}{
+		{message, map[string]string{"chat_id": "-1001", "message_id": "5"}, "@news"},
+		{&message, map[string]string{"chat_id": "-1001", "message_id": "5"}, "@news"},
+		{Callback{Message: message}, map[string]string{"chat_id": "-1001", "message_id": "5"}, "@news"},
+		{Callback{Message: message, MessageID: "AAQ"}, map[string]string{"inline_message_id": "AAQ"}, "AAQ"},
+		{InlineMessageID("BBQ"), map[string]string{"inline_message_id": "BBQ"}, "BBQ"},
+	}
+	for _, c := range cases {
+		r, err := newEditRequest("editMessageText", c.editable)
+		if err != nil || !reflect.DeepEqual(r.params, c.params) || r.to.Destination() != c.to {
+			t.Errorf("%#v: got %v for %v, %v", c.editable, r, c.to, err)
+		}
+	}
+
+	// Без ID чата сообщение нельзя принять за inline-сообщение
+	for _, e := range []Editable{Message{ID: 5}, &Message{ID: 5}, Callback{Message: Message{ID: 5}}} {
+		if _, err := newEditRequest("editMessageText", e); err == nil {
+			t.Errorf("%#v: message without chat must be rejected", e)
+		}
+	}
+}
+
+func TestEditPayloads(t *testing.T) {
+	message := Message{ID: 5, Chat: Chat{ID: 10, Type: "private"}}
+	keyboard := ReplyMarkup{InlineKeyboard: [][]KeyboardButton{{{Text: "Next", Data: "next"}}}}
+	markupJSON := `{"inline_keyboard":[[{"text":"Next","callback_data":"next"}]]}`
+
+	r, _ := captionEdit(message, "*new*", &SendOptions{ParseMode: ModeMarkdownV2, ReplyMarkup: keyboard,
+		Entities: []MessageEntity{{Type: "bold", Offset: 0, Length: 3}}})
+	if r.method != "editMessageCaption" || r.params["caption"] != "*new*" || r.params["parse_mode"] != "MarkdownV2" ||
+		r.params["caption_entities"] == "" || r.params["reply_markup"] != markupJSON {
+		t.Fatal("Wrong caption payload:", r.params)
+	}
+
+	r, _ = markupEdit(message, &keyboard)
+	if r.method != "editMessageReplyMarkup" || r.params["reply_markup"] != markupJSON || len(r.params) != 3 {
+		t.Fatal("Wrong reply markup payload:", r.params)
+	}
+	if r, _ = markupEdit(message, nil); len(r.params) != 2 {
+		t.Fatal("Nil markup must remove the keyboard:", r.params)
+	}
+
+	f, err := ioutil.TempFile("", "telebot-media")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	file, _ := NewFile(f.Name())
+
+	var media map[string]string
+	r, _ = mediaEdit(message, InputMedia{Type: "photo", File: file, Caption: "cat"},
+		&SendOptions{ParseMode: ModeHTML, ReplyMarkup: keyboard})
+	json.Unmarshal([]byte(r.params["media"]), &media)
+	// Файл загружается отдельной частью формы, не "media" с описанием
+	if r.upload != f.Name() || r.uploadName == "" || r.uploadName == "media" || r.params[r.uploadName] != "" ||
+		media["media"] != "attach://"+r.uploadName || media["type"] != "photo" || media["caption"] != "cat" {
+		t.Fatal("Local file must be attached under its own name:", r.uploadName, r.params)
+	}
+	if r.params["reply_markup"] != markupJSON || r.params["parse_mode"] != "" {
+		t.Fatal("Only reply markup must be taken from options:", r.params)
+	}
+
+	r, _ = mediaEdit(InlineMessageID("AAQ"), InputMedia{Type: "video", File: File{FileID: "BAAD"}}, nil)
+	media = nil
+	json.Unmarshal([]byte(r.params["media"]), &media)
+	if r.upload != "" || media["media"] != "BAAD" || r.params["inline_message_id"] != "AAQ" {
+		t.Fatal("Wrong payload for a file on Telegram servers:", r.params)
+	}
+}
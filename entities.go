@@ -0,0 +1,114 @@
+package telebot
+
+import "unicode/utf16"
+
+// Entity - MessageEntity вместе с текстом, который она выделяет.
+type Entity struct {
+	MessageEntity
+	Text string
+}
+
+// EntityText возвращает часть Text или Caption, которую выделяет entity.
+// Offset и Length сущностей считаются в единицах UTF-16, поэтому срез
+// строки Go по ним дает неверный результат для эмодзи и кириллицы.
+func (m *Message) EntityText(entity MessageEntity) string {
+	text, _ := m.entitySource()
+	return utf16Substring(utf16.Encode([]rune(text)), entity.Offset, entity.Length)
+}
+
+// AllEntities возвращает сущности текста, а для медиа - сущности подписи,
+// с выделенным текстом.
+func (m *Message) AllEntities() []Entity {
+	return m.entitiesOf()
+}
+
+// Commands возвращает команды боту, например "/start" или "/start@bot".
+func (m *Message) Commands() []Entity {
+	return m.entitiesOf("bot_command")
+}
+
+// Mentions возвращает упоминания "@username" и пользователей без username.
+func (m *Message) Mentions() []Entity {
+	return m.entitiesOf("mention", "text_mention")
+}
+
+// Hashtags возвращает хэштеги вида "#tag".
+func (m *Message) Hashtags() []Entity {
+	return m.entitiesOf("hashtag")
+}
+
+// Cashtags возвращает тикеры валют и акций вида "$USD".
+func (m *Message) Cashtags() []Entity {
+	return m.entitiesOf("cashtag")
+}
+
+// URLs возвращает ссылки, написанные в тексте. Ссылки под текстом
+// возвращает TextLinks.
+func (m *Message) URLs() []Entity {
+	return m.entitiesOf("url")
+}
+
+// Emails возвращает адреса электронной почты.
+func (m *Message) Emails() []Entity {
+	return m.entitiesOf("email")
+}
+
+// TextLinks возвращает ссылки под текстом: адрес в Url, видимый текст в Text.
+func (m *Message) TextLinks() []Entity {
+	return m.entitiesOf("text_link")
+}
+
+// entitySource возвращает текст и его сущности: Text или Caption.
+func (m *Message) entitySource() (string, []MessageEntity) {
+	if m.Text != "" || len(m.Entities) > 0 {
+		return m.Text, m.Entities
+	}
+	return m.Caption, m.CaptionEntities
+}
+
+// entitiesOf возвращает сущности заданных типов, без типов - все.
+func (m *Message) entitiesOf(types ...string) []Entity {
+	text, entities := m.entitySource()
+	if len(entities) == 0 {
+		return nil
+	}
+	units := utf16.Encode([]rune(text))
+
+	var result []Entity
+	for _, entity := range entities {
+		if len(types) > 0 && !containsString(types, entity.Type) {
+			continue
+		}
+		result = append(result, Entity{
+			MessageEntity: entity,
+			Text:          utf16Substring(units, entity.Offset, entity.Length),
+		})
+	}
+	return result
+}
+
+// utf16Substring возвращает length единиц UTF-16 начиная с offset.
+// Границы, выходящие за текст, обрезаются.
+func utf16Substring(units []uint16, offset, length int) string {
+	if offset < 0 {
+		length += offset
+		offset = 0
+	}
+	if offset > len(units) || length <= 0 {
+		return ""
+	}
+	end := offset + length
+	if end > len(units) {
+		end = len(units)
+	}
+	return string(utf16.Decode(units[offset:end]))
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package telebot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMessageEntities(t *testing.T) {
+	// "👍" занимает две единицы UTF-16, кириллица - по одной
+	var m Message
+	json.Unmarshal([]byte(`{
+		"text": "👍 /start@bot Привет @ivan #новости $USD https://example.com mail@example.com сайт",
+		"entities": [
+			{"type": "bot_command", "offset": 3, "length": 10},
+			{"type": "mention", "offset": 21, "length": 5},
+			{"type": "hashtag", "offset": 27, "length": 8},
+			{"type": "cashtag", "offset": 36, "length": 4},
+			{"type": "url", "offset": 41, "length": 19},
+			{"type": "email", "offset": 61, "length": 16},
+			{"type": "text_link", "offset": 78, "length": 4, "url": "https://example.org"}
+		]
+	}`), &m)
+
+	checks := map[string][]Entity{
+		"/start@bot":          m.Commands(),
+		"@ivan":               m.Mentions(),
+		"#новости":            m.Hashtags(),
+		"$USD":                m.Cashtags(),
+		"https://example.com": m.URLs(),
+		"mail@example.com":    m.Emails(),
+		"сайт":                m.TextLinks(),
+	}
+	for text, entities := range checks {
+		if len(entities) != 1 || entities[0].Text != text {
+			t.Errorf("Expected %q, got %v", text, entities)
+		}
+	}
+	if link := m.TextLinks()[0]; link.Url != "https://example.org" {
+		t.Fatal("Text link must keep its URL:", link)
+	}
+	if len(m.AllEntities()) != 7 || m.EntityText(m.Entities[1]) != "@ivan" {
+		t.Fatal("Wrong entity text.")
+	}
+
+	caption := Message{
+		Caption:         "Фото 🐱 #кот",
+		CaptionEntities: []MessageEntity{{Type: "hashtag", Offset: 8, Length: 4}},
+	}
+	if tags := caption.Hashtags(); len(tags) != 1 || tags[0].Text != "#кот" {
+		t.Fatal("Caption entities must be resolved against the caption:", tags)
+	}
+	if text := caption.EntityText(MessageEntity{Offset: 5, Length: 100}); text != "🐱 #кот" {
+		t.Fatal("Entity bounds must be clamped, got", text)
+	}
+}
@@ -16,8 +16,50 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 )
 
+// APIError is an error returned by Telegram Bot API.
+// See also: https://core.telegram.org/bots/api#making-requests
+type APIError struct {
+	// HTTP-like error code, e.g. 400, 403 or 429.
+	Code int
+
+	Description string
+
+	// (Optional) The group has been migrated to a supergroup
+	// with the specified identifier.
+	MigrateTo int64
+
+	// (Optional) In case of exceeding flood control, the number
+	// of seconds left to wait before the request can be repeated.
+	RetryAfter int
+}
+
+func (e *APIError) Error() string {
+	return "telebot: " + e.Description
+}
+
+// newAPIError builds an APIError from a response with "ok": false.
+func newAPIError(responseJSON []byte) error {
+	var response struct {
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+		Parameters  struct {
+			MigrateTo  int64 `json:"migrate_to_chat_id"`
+			RetryAfter int   `json:"retry_after"`
+		} `json:"parameters"`
+	}
+	json.Unmarshal(responseJSON, &response)
+
+	return &APIError{
+		Code:        response.ErrorCode,
+		Description: response.Description,
+		MigrateTo:   response.Parameters.MigrateTo,
+		RetryAfter:  response.Parameters.RetryAfter,
+	}
+}
+
 func sendCommand(method, token string, payload interface{}) ([]byte, error) {
 	url := fmt.Sprintf("https://api.telegram.org/bot%s/%s", token, method)
 
@@ -32,6 +74,11 @@ func sendCommand(method, token string, payload interface{}) ([]byte, error) {
 	}
 	resp.Close = true
 	defer resp.Body.Close()
+	// Gateway errors may come with a non-JSON body.
+	if resp.StatusCode >= http.StatusInternalServerError &&
+		!strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return []byte{}, &APIError{Code: resp.StatusCode, Description: http.StatusText(resp.StatusCode)}
+	}
 	json, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return []byte{}, err
@@ -80,9 +127,11 @@ func sendFile(method, token, name, path string, params map[string]string) ([]byt
 		return []byte{}, err
 	}
 
-	if resp.StatusCode == http.StatusInternalServerError {
-		return []byte{}, fmt.Errorf("telegram: internal server error")
+	if resp.StatusCode >= http.StatusInternalServerError {
+		resp.Body.Close()
+		return []byte{}, &APIError{Code: resp.StatusCode, Description: http.StatusText(resp.StatusCode)}
 	}
+	defer resp.Body.Close()
 
 	json, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -113,6 +162,15 @@ func embedSendOptions(params map[string]string, options *SendOptions) {
 		params["parse_mode"] = string(options.ParseMode)
 	}
 
+	if len(options.Entities) > 0 {
+		entities, _ := json.Marshal(options.Entities)
+		if _, ok := params["text"]; ok {
+			params["entities"] = string(entities)
+		} else {
+			params["caption_entities"] = string(entities)
+		}
+	}
+
 	// Processing force_reply:
 	{
 		forceReply := options.ReplyMarkup.ForceReply
@@ -147,7 +205,7 @@ func getMe(token string) (User, error) {
 		return botInfo.Result, nil
 	}
 
-	return User{}, fmt.Errorf("telebot: %s", botInfo.Description)
+	return User{}, newAPIError(meJSON)
 }
 
 func getUpdates(token string, offset, timeout int) (upd []Update, err error) {
@@ -172,7 +230,7 @@ func getUpdates(token string, offset, timeout int) (upd []Update, err error) {
 	}
 
 	if !updatesRecieved.Ok {
-		err = fmt.Errorf("telebot: %s", updatesRecieved.Description)
+		err = newAPIError(updatesJSON)
 		return
 	}
 
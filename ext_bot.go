@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"sync"
 	"time"
 	"github.com/pkg/errors"
 )
@@ -21,6 +22,18 @@ type Bot struct {
 	Messages  chan Message
 	Queries   chan Query
 	Callbacks chan Callback
+
+	// Incoming, if set, drops messages and callbacks from flooding
+	// users and chats before they reach Messages and Callbacks.
+	Incoming *IncomingLimiter
+
+	// Limiter, if set, delays outgoing messages, deletions and edits
+	// to stay within Telegram rate limits. It is nil by default; use
+	// NewRateLimiter(DefaultRateLimits) to opt in.
+	Limiter *RateLimiter
+
+	deferredMu sync.Mutex
+	deferred   *DeferredSender
 }
 
 // NewBot does try to build a Bot with token `token`, which
@@ -69,6 +82,11 @@ func (b *Bot) poll(
 		}
 
 		for _, update := range updates {
+			if b.Incoming != nil && !b.Incoming.admit(b, update) {
+				latestUpdate = update.ID
+				continue
+			}
+
 			if update.Payload != nil /* if message */ {
 				if messages == nil {
 					continue
@@ -107,6 +125,8 @@ type BotInfo struct {
 
 // SendMessage sends a text message to recipient.
 func (b *Bot) SendMessage(recipient Recipient, message string, options *SendOptions) (result *MsgResult, Error error) {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 		"text":    message,
@@ -133,7 +153,7 @@ func (b *Bot) SendMessage(recipient Recipient, message string, options *SendOpti
 	}
 
 	if !responseRecieved.Ok {
-		return nil, fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return nil, newAPIError(responseJSON)
 	}
 
 	return &responseRecieved.Result, nil
@@ -141,6 +161,8 @@ func (b *Bot) SendMessage(recipient Recipient, message string, options *SendOpti
 
 // ForwardMessage forwards a message to recipient.
 func (b *Bot) ForwardMessage(recipient Recipient, message Message) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id":      recipient.Destination(),
 		"from_chat_id": strconv.Itoa(message.Origin().ID),
@@ -163,47 +185,15 @@ func (b *Bot) ForwardMessage(recipient Recipient, message Message) error {
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
-	}
-
-	return nil
-}
-
-// EditMessage sends a text message to recipient.
-func (b *Bot) EditMessageText(message Message, text string, options *SendOptions) error {
-	params := map[string]string{
-		"chat_id":    strconv.FormatInt(message.Chat.ID, 10),
-		"message_id": strconv.Itoa(message.ID),
-		"text":       text,
-	}
-
-	if options != nil {
-		embedSendOptions(params, options)
-	}
-
-	responseJSON, err := sendCommand("editMessageText", b.Token, params)
-	if err != nil {
-		return err
-	}
-
-	var responseRecieved struct {
-		Ok          bool
-		Description string
-	}
-
-	err = json.Unmarshal(responseJSON, &responseRecieved)
-	if err != nil {
-		return err
-	}
-
-	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
 }
 
 func (b *Bot) DeleteMessage(message Message) error {
+	b.limit(message.Chat)
+
 	params := map[string]string{
 		"chat_id":    strconv.FormatInt(message.Chat.ID, 10),
 		"message_id": strconv.Itoa(message.ID),
@@ -224,7 +214,7 @@ func (b *Bot) DeleteMessage(message Message) error {
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -237,6 +227,13 @@ func (b *Bot) DeleteMessage(message Message) error {
 // again, won't issue a new upload, but would make a use
 // of existing file on Telegram servers.
 func (b *Bot) SendPhoto(recipient Recipient, photo *Photo, options *SendOptions) error {
+	_, err := b.sendPhoto(recipient, photo, options)
+	return err
+}
+
+func (b *Bot) sendPhoto(recipient Recipient, photo *Photo, options *SendOptions) (*MsgResult, error) {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 		"caption": photo.Caption,
@@ -265,7 +262,7 @@ func (b *Bot) SendPhoto(recipient Recipient, photo *Photo, options *SendOptions)
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	var responseRecieved struct {
@@ -276,11 +273,11 @@ func (b *Bot) SendPhoto(recipient Recipient, photo *Photo, options *SendOptions)
 
 	err = json.Unmarshal(responseJSON, &responseRecieved)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return nil, newAPIError(responseJSON)
 	}
 
 	thumbnails := &responseRecieved.Result.Photo
@@ -288,7 +285,7 @@ func (b *Bot) SendPhoto(recipient Recipient, photo *Photo, options *SendOptions)
 	photo.File = (*thumbnails)[len(*thumbnails)-1].File
 	photo.filename = filename
 
-	return nil
+	return &MsgResult{Message_id: responseRecieved.Result.ID}, nil
 }
 
 // SendAudio sends an audio object to recipient.
@@ -298,6 +295,8 @@ func (b *Bot) SendPhoto(recipient Recipient, photo *Photo, options *SendOptions)
 // again, won't issue a new upload, but would make a use
 // of existing file on Telegram servers.
 func (b *Bot) SendAudio(recipient Recipient, audio *Audio, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 	}
@@ -333,7 +332,7 @@ func (b *Bot) SendAudio(recipient Recipient, audio *Audio, options *SendOptions)
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	filename := audio.filename
@@ -350,6 +349,8 @@ func (b *Bot) SendAudio(recipient Recipient, audio *Audio, options *SendOptions)
 // again, won't issue a new upload, but would make a use
 // of existing file on Telegram servers.
 func (b *Bot) SendDocument(recipient Recipient, doc *Document, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 	}
@@ -385,7 +386,7 @@ func (b *Bot) SendDocument(recipient Recipient, doc *Document, options *SendOpti
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	filename := doc.filename
@@ -402,6 +403,8 @@ func (b *Bot) SendDocument(recipient Recipient, doc *Document, options *SendOpti
 // again, won't issue a new upload, but would make a use
 // of existing file on Telegram servers.
 func (b *Bot) SendSticker(recipient Recipient, sticker *Sticker, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 	}
@@ -437,7 +440,7 @@ func (b *Bot) SendSticker(recipient Recipient, sticker *Sticker, options *SendOp
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	filename := sticker.filename
@@ -454,6 +457,8 @@ func (b *Bot) SendSticker(recipient Recipient, sticker *Sticker, options *SendOp
 // again, won't issue a new upload, but would make a use
 // of existing file on Telegram servers.
 func (b *Bot) SendVideo(recipient Recipient, video *Video, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 	}
@@ -489,7 +494,7 @@ func (b *Bot) SendVideo(recipient Recipient, video *Video, options *SendOptions)
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	filename := video.filename
@@ -506,6 +511,8 @@ func (b *Bot) SendVideo(recipient Recipient, video *Video, options *SendOptions)
 // again, won't issue a new upload, but would make a use
 // of existing file on Telegram servers.
 func (b *Bot) SendLocation(recipient Recipient, geo *Location, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id":   recipient.Destination(),
 		"latitude":  fmt.Sprintf("%f", geo.Latitude),
@@ -533,7 +540,7 @@ func (b *Bot) SendLocation(recipient Recipient, geo *Location, options *SendOpti
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -541,6 +548,8 @@ func (b *Bot) SendLocation(recipient Recipient, geo *Location, options *SendOpti
 
 // SendVenue sends a venue object to recipient.
 func (b *Bot) SendVenue(recipient Recipient, venue *Venue, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id":   recipient.Destination(),
 		"latitude":  fmt.Sprintf("%f", venue.Location.Latitude),
@@ -572,7 +581,7 @@ func (b *Bot) SendVenue(recipient Recipient, venue *Venue, options *SendOptions)
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -588,6 +597,8 @@ func (b *Bot) SendVenue(recipient Recipient, venue *Venue, options *SendOptions)
 // Currently, Telegram supports only a narrow range of possible
 // actions, these are aligned as constants of this package.
 func (b *Bot) SendChatAction(recipient Recipient, action string) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 		"action":  action,
@@ -609,7 +620,7 @@ func (b *Bot) SendChatAction(recipient Recipient, action string) error {
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -644,7 +655,7 @@ func (b *Bot) Respond(query Query, results []Result) error {
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -672,7 +683,7 @@ func (b *Bot) AnswerInlineQuery(query *Query, response *QueryResponse) error {
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -700,7 +711,7 @@ func (b *Bot) AnswerCallbackQuery(callback *Callback, response *CallbackResponse
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -778,7 +789,7 @@ func (b *Bot) GetFile(fileId string) (*File, error) {
 	}
 
 	if !responseRecieved.Ok {
-		return nil, fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return nil, newAPIError(responseJSON)
 	}
 
 	file := File{
@@ -792,6 +803,8 @@ func (b *Bot) GetFile(fileId string) (*File, error) {
 
 // SendPhoto sends a photo object to recipient.
 func (b *Bot) SendPhotoAsLink(recipient Recipient, photoUrl string, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 		"caption": "!!!",
@@ -824,7 +837,7 @@ func (b *Bot) SendPhotoAsLink(recipient Recipient, photoUrl string, options *Sen
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -832,6 +845,8 @@ func (b *Bot) SendPhotoAsLink(recipient Recipient, photoUrl string, options *Sen
 
 // SendPhoto sends a photo object to recipient.
 func (b *Bot) SendVideoAsLink(recipient Recipient, videoUrl string, options *SendOptions) error {
+	b.limit(recipient)
+
 	params := map[string]string{
 		"chat_id": recipient.Destination(),
 	}
@@ -862,7 +877,7 @@ func (b *Bot) SendVideoAsLink(recipient Recipient, videoUrl string, options *Sen
 	}
 
 	if !responseRecieved.Ok {
-		return fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return newAPIError(responseJSON)
 	}
 
 	return nil
@@ -890,7 +905,7 @@ func (b *Bot) GetMe() (*BotInfo, error) {
 	}
 
 	if !responseRecieved.Ok {
-		return nil, fmt.Errorf("telebot: %s", responseRecieved.Description)
+		return nil, newAPIError(responseJSON)
 	}
 
 	return &responseRecieved.Result, nil
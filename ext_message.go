@@ -16,6 +16,12 @@ type Message struct {
 	// For message sent to channels, Sender may be empty
 	Sender User `json:"from"`
 
+	// (Optional) Sender of the message, sent on behalf of a chat: the channel
+	// itself for channel posts, the supergroup itself for messages from
+	// anonymous group administrators, the linked channel for messages
+	// automatically forwarded to the discussion group.
+	SenderChat Chat `json:"sender_chat"`
+
 	Unixtime int `json:"date"`
 
 	// For forwarded messages, sender of the original message.
@@ -24,12 +30,48 @@ type Message struct {
 	// For forwarded messages, unixtime of the original message.
 	OriginalUnixtime int `json:"forward_date"`
 
+	// For messages forwarded from a channel, information about
+	// the original channel.
+	OriginalChat Chat `json:"forward_from_chat"`
+
+	// For messages forwarded from a channel, identifier of
+	// the original message in the channel.
+	OriginalMessageID int `json:"forward_from_message_id"`
+
+	// For messages forwarded from a channel, signature of
+	// the post author if present.
+	OriginalSignature string `json:"forward_signature"`
+
+	// For messages forwarded from users who hide their account,
+	// name of the original sender.
+	OriginalSenderName string `json:"forward_sender_name"`
+
+	// (Optional) True, if the message is a channel post that was
+	// automatically forwarded to the connected discussion group.
+	AutomaticForward bool `json:"is_automatic_forward"`
+
 	// For replies, ReplyTo represents the original message.
 	// Note that the Message object in this field will not
 	// contain further ReplyTo fields even if it
 	// itself is a reply.
 	ReplyTo *Message `json:"reply_to_message"`
 
+	// (Optional) Bot through which the message was sent in inline mode.
+	ViaBot User `json:"via_bot"`
+
+	// (Optional) Unixtime of the last edit of the message.
+	LastEdit int `json:"edit_date"`
+
+	// (Optional) The unique identifier of a media message group
+	// (album) this message belongs to.
+	AlbumID string `json:"media_group_id"`
+
+	// (Optional) True, if the message can't be forwarded or saved.
+	Protected bool `json:"has_protected_content"`
+
+	// (Optional) Signature of the post author for messages in channels.
+	Signature string `json:"author_signature"`
+
 	// For a text message, the actual UTF-8 text of the message
 	Text string `json:"text"`
 
@@ -51,12 +93,42 @@ type Message struct {
 	// For a video, information about it.
 	Video Video `json:"video"`
 
+	// For a voice note, information about it.
+	Voice Voice `json:"voice"`
+
+	// For a round video message, information about it.
+	VideoNote VideoNote `json:"video_note"`
+
+	// For an animation (GIF), information about it. For backward
+	// compatibility, Document is also set in this case.
+	Animation Animation `json:"animation"`
+
+	// For a game, information about it.
+	Game Game `json:"game"`
+
+	// For an invoice for a payment, information about it.
+	Invoice Invoice `json:"invoice"`
+
+	// For a service message about a successful payment,
+	// information about the payment.
+	Payment SuccessfulPayment `json:"successful_payment"`
+
 	// For a contact, contact information itself.
 	Contact Contact `json:"contact"`
 
 	// For a location, its longitude and latitude.
 	Location Location `json:"location"`
 
+	// For a venue, information about it. For backward
+	// compatibility, Location is also set in this case.
+	Venue Venue `json:"venue"`
+
+	// For a native poll, information about the poll.
+	Poll Poll `json:"poll"`
+
+	// For a dice with random value, information about it.
+	Dice Dice `json:"dice"`
+
 	// A group chat message belongs to, empty if personal.
 	Chat Chat `json:"chat"`
 
@@ -68,6 +140,10 @@ type Message struct {
 	// UserJoined might be the Bot itself.
 	UserJoined User `json:"new_chat_member"`
 
+	// For a service message, represents all users that just got
+	// added to chat, UserJoined holds the first of them.
+	UsersJoined []User `json:"new_chat_members"`
+
 	// For a service message, represents a user,
 	// that just left chat, this message came from.
 	//
@@ -137,11 +213,26 @@ type Message struct {
 	// Sender would lead to creator of the migration.
 	MigrateFrom int64 `json:"migrate_from_chat_id"`
 
+	// For a service message, the message that has been pinned.
+	//
+	// Note that the Message object in this field will not
+	// contain further ReplyTo fields even if it
+	// itself is a reply.
+	PinnedMessage *Message `json:"pinned_message"`
+
 	// For text messages, special entities like usernames, URLs, bot commands, etc. that appear in the text
 	Entities []MessageEntity `json:"entities",omitempty`
 
 	// For messages with a caption, special entities like usernames, URLs, bot commands, etc. that appear in the caption
 	CaptionEntities []MessageEntity `json:"caption_entities",omitempty`
+
+	// (Optional) Inline keyboard attached to the message.
+	// Login URL buttons are represented as ordinary URL buttons.
+	ReplyMarkup InlineKeyboardMarkup `json:"reply_markup"`
+
+	// For a service message, the domain name of the website
+	// on which the user has logged in.
+	ConnectedWebsite string `json:"connected_website"`
 }
 
 // Origin returns an origin of message: group chat / personal.
@@ -158,10 +249,19 @@ func (m *Message) Time() time.Time {
 	return time.Unix(int64(m.Unixtime), 0)
 }
 
+// LastEdited returns the moment of the last edit in local time,
+// zero time if message was never edited.
+func (m *Message) LastEdited() time.Time {
+	if m.LastEdit == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(m.LastEdit), 0)
+}
+
 // IsForwarded says whether message is forwarded copy of another
 // message or not.
 func (m *Message) IsForwarded() bool {
-	return m.OriginalSender != User{}
+	return m.OriginalSender != User{} || m.OriginalChat != Chat{} || m.OriginalSenderName != ""
 }
 
 // IsReply says whether message is reply to another message or not.
@@ -182,31 +282,5 @@ func (m *Message) IsPersonal() bool {
 // typically occur on some global action. For instance, when
 // anyone leaves the chat or chat title changes.
 func (m *Message) IsService() bool {
-	service := false
-
-	if (m.UserJoined != User{}) {
-		service = true
-	}
-
-	if (m.UserLeft != User{}) {
-		service = true
-	}
-
-	if m.NewChatTitle != "" {
-		service = true
-	}
-
-	if len(m.NewChatPhoto) > 0 {
-		service = true
-	}
-
-	if m.ChatPhotoDeleted {
-		service = true
-	}
-
-	if m.ChatCreated {
-		service = true
-	}
-
-	return service
+	return m.Kind().IsService()
 }
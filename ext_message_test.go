@@ -0,0 +1,187 @@
+package telebot
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// Фрагменты Message из Bot API по группам полей.
+var messageFixtures = map[string]string{
+	"media": `{
+		"message_id": 1, "date": 1500000000, "chat": {"id": 10, "type": "private"},
+		"voice": {"file_id": "voice", "file_size": 100, "duration": 3, "mime_type": "audio/ogg"},
+		"video_note": {"file_id": "note", "length": 240, "duration": 5,
+			"thumb": {"file_id": "thumb", "width": 90, "height": 90}},
+		"animation": {"file_id": "gif", "width": 320, "height": 240, "duration": 2,
+			"thumb": {"file_id": "thumb", "width": 90, "height": 60}, "file_name": "cat.mp4", "mime_type": "video/mp4"},
+		"document": {"file_id": "gif", "file_name": "cat.mp4", "mime_type": "video/mp4"},
+		"media_group_id": "13064849931306514"
+	}`,
+	"game": `{
+		"message_id": 2, "date": 1500000000, "chat": {"id": 10, "type": "private"},
+		"game": {"title": "Snake", "description": "Classic", "text": "Score: 10",
+			"photo": [{"file_id": "photo", "width": 640, "height": 360}],
+			"text_entities": [{"type": "bold", "offset": 0, "length": 5}],
+			"animation": {"file_id": "gif", "width": 320, "height": 240, "duration": 2}}
+	}`,
+	"payments": `{
+		"message_id": 3, "date": 1500000000, "chat": {"id": 10, "type": "private"},
+		"invoice": {"title": "Pro", "description": "One month", "start_parameter": "pro",
+			"currency": "RUB", "total_amount": 29900},
+		"successful_payment": {"currency": "RUB", "total_amount": 29900, "invoice_payload": "order-42",
+			"shipping_option_id": "post",
+			"order_info": {"name": "Ivan", "phone_number": "+70000000000", "email": "ivan@example.com",
+				"shipping_address": {"country_code": "RU", "state": "", "city": "Moscow",
+					"street_line1": "Tverskaya 1", "street_line2": "", "post_code": "125009"}},
+			"telegram_payment_charge_id": "tg", "provider_payment_charge_id": "provider"}
+	}`,
+	"forward": `{
+		"message_id": 4, "date": 1500000000, "chat": {"id": 10, "type": "private"},
+		"forward_from_chat": {"id": -1001, "type": "channel", "title": "News", "username": "news"},
+		"forward_from_message_id": 77, "forward_signature": "Editor", "forward_date": 1490000000,
+		"text": "Breaking"
+	}`,
+	"channel": `{
+		"message_id": 5, "date": 1500000000, "chat": {"id": -1001, "type": "channel", "title": "News"},
+		"author_signature": "Editor", "edit_date": 1500000100, "text": "Updated"
+	}`,
+	"poll": `{
+		"message_id": 7, "date": 1500000000, "chat": {"id": -20, "type": "group", "title": "Team"},
+		"poll": {"id": "5001", "question": "2+2?", "total_voter_count": 3, "is_closed": true,
+			"is_anonymous": false, "type": "quiz", "allows_multiple_answers": false, "correct_option_id": 1,
+			"options": [{"text": "3", "voter_count": 1}, {"text": "4", "voter_count": 2}],
+			"explanation": "Math", "explanation_entities": [{"type": "italic", "offset": 0, "length": 4}],
+			"open_period": 60, "close_date": 1500000060}
+	}`,
+	"dice": `{
+		"message_id": 8, "date": 1500000000, "chat": {"id": 10, "type": "private"},
+		"dice": {"emoji": "🎲", "value": 6}
+	}`,
+	"origin": `{
+		"message_id": 9, "date": 1500000000, "chat": {"id": -1002, "type": "supergroup", "title": "Talks"},
+		"sender_chat": {"id": -1001, "type": "channel", "title": "News", "username": "news"},
+		"is_automatic_forward": true, "has_protected_content": true,
+		"forward_sender_name": "Hidden User", "forward_date": 1490000000,
+		"via_bot": {"id": 100, "first_name": "Gif", "username": "gif"},
+		"text": "Post",
+		"reply_markup": {"inline_keyboard": [[{"text": "Open", "url": "https://example.com"},
+			{"text": "Like", "callback_data": "like"}]]}
+	}`,
+	"website": `{
+		"message_id": 10, "date": 1500000000, "chat": {"id": 10, "type": "private"},
+		"connected_website": "example.com"
+	}`,
+	"service": `{
+		"message_id": 6, "date": 1500000000, "chat": {"id": -20, "type": "group", "title": "Team"},
+		"new_chat_member": {"id": 7, "first_name": "Ann"},
+		"new_chat_members": [{"id": 7, "first_name": "Ann"}, {"id": 8, "first_name": "Bob", "username": "bob"}],
+		"pinned_message": {"message_id": 5, "date": 1490000000, "chat": {"id": -20, "type": "group"}, "text": "Rules"}
+	}`,
+}
+
+func TestMessageFixtures(t *testing.T) {
+	for group, fixture := range messageFixtures {
+		var m Message
+		if err := json.Unmarshal([]byte(fixture), &m); err != nil {
+			t.Fatal(group, err)
+		}
+		data, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(group, err)
+		}
+
+		var roundTrip Message
+		json.Unmarshal(data, &roundTrip)
+		if !reflect.DeepEqual(m, roundTrip) {
+			t.Errorf("%s: message changed after round trip", group)
+		}
+
+		var want, got interface{}
+		json.Unmarshal([]byte(fixture), &want)
+		json.Unmarshal(data, &got)
+		if path, ok := jsonContains(got, want, group); !ok {
+			t.Errorf("field %s is lost", path)
+		}
+	}
+
+	var m Message
+	json.Unmarshal([]byte(messageFixtures["service"]), &m)
+	if !m.IsService() || len(m.UsersJoined) != 2 || m.PinnedMessage.Text != "Rules" {
+		t.Fatal("Service message is not parsed:", m)
+	}
+	m = Message{}
+	json.Unmarshal([]byte(messageFixtures["origin"]), &m)
+	if !m.IsForwarded() || !m.AutomaticForward || !m.Protected || m.SenderChat.ID != -1001 ||
+		m.ViaBot.Username != "gif" || m.ReplyMarkup.InlineKeyboard[0][1].Data != "like" {
+		t.Fatal("Message origin is not parsed:", m)
+	}
+	m = Message{}
+	json.Unmarshal([]byte(messageFixtures["forward"]), &m)
+	if !m.IsForwarded() || m.OriginalChat.Destination() != "@news" || m.OriginalMessageID != 77 {
+		t.Fatal("Channel forward is not parsed:", m)
+	}
+}
+
+// jsonContains проверяет, что каждое поле want есть в got с тем же значением.
+func jsonContains(got, want interface{}, path string) (string, bool) {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		got, ok := got.(map[string]interface{})
+		if !ok {
+			return path, false
+		}
+		for key, value := range want {
+			if p, ok := jsonContains(got[key], value, path+"."+key); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	case []interface{}:
+		got, ok := got.([]interface{})
+		if !ok || len(got) != len(want) {
+			return path, false
+		}
+		for i := range want {
+			if p, ok := jsonContains(got[i], want[i], path+"[]"); !ok {
+				return p, false
+			}
+		}
+		return path, true
+	}
+	return path, reflect.DeepEqual(got, want)
+}
+
+func TestMessageKind(t *testing.T) {
+	kinds := map[string]MessageKind{
+		`{"text": "hello"}`: KindText,
+		`{"text": "/start payload", "entities": [{"type": "bot_command", "offset": 0, "length": 6}]}`: KindCommand,
+		`{"text": "see /start", "entities": [{"type": "bot_command", "offset": 4, "length": 6}]}`:     KindText,
+		`{"photo": [{"file_id": "p"}], "caption": "cat"}`:                                             KindPhoto,
+		`{"animation": {"file_id": "a"}, "document": {"file_id": "a"}}`:                               KindAnimation,
+		`{"voice": {"file_id": "v"}}`:                                                                 KindVoice,
+		`{"venue": {"title": "Cafe", "location": {"latitude": 1}}, "location": {"latitude": 1}}`:      KindVenue,
+		`{"location": {"latitude": 55.7, "longitude": 37.6}}`:                                         KindLocation,
+		`{"poll": {"id": "1", "question": "?"}}`:                                                      KindPoll,
+		`{"dice": {"emoji": "🎯", "value": 3}}`:                                                        KindDice,
+		`{"contact": {"phone_number": "+7"}}`:                                                         KindContact,
+		`{"new_chat_members": [{"id": 1}]}`:                                                           KindMembersJoined,
+		`{"left_chat_member": {"id": 1}}`:                                                             KindMemberLeft,
+		`{"new_chat_title": "Team"}`:                                                                  KindTitleChanged,
+		`{"migrate_to_chat_id": -1001}`:                                                               KindMigratedTo,
+		`{"pinned_message": {"message_id": 1}}`:                                                       KindPinned,
+		`{}`:                                                                                          KindUnknown,
+	}
+	for fixture, kind := range kinds {
+		var m Message
+		if err := json.Unmarshal([]byte(fixture), &m); err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Kind(); got != kind {
+			t.Errorf("Expected %s, got %s for %s", kind, got, fixture)
+		}
+		if m.IsService() != kind.IsService() {
+			t.Errorf("IsService must agree with Kind for %s", fixture)
+		}
+	}
+}
@@ -13,6 +13,8 @@ const (
 	ModeDefault  ParseMode = ""
 	ModeMarkdown ParseMode = "Markdown"
 	ModeHTML     ParseMode = "HTML"
+
+	ModeMarkdownV2 ParseMode = "MarkdownV2"
 )
 
 // SendOptions represents a set of custom options that could
@@ -32,6 +34,9 @@ type SendOptions struct {
 
 	// ParseMode controls how client apps render your message.
 	ParseMode ParseMode
+
+	// Entities of the text or caption, used instead of ParseMode.
+	Entities []MessageEntity
 }
 
 // ReplyMarkup specifies convenient options for bot-user communications.
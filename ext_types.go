@@ -23,6 +23,9 @@ type User struct {
 
 	LastName string `json:"last_name"`
 	Username string `json:"username"`
+
+	// IETF language tag of the user's language, if known.
+	LanguageCode string `json:"language_code"`
 }
 
 // Destination is internal user ID.
@@ -137,6 +140,121 @@ type Video struct {
 	Preview Thumbnail `json:"thumb"`
 }
 
+// Voice object represents a voice note.
+type Voice struct {
+	File
+
+	// Duration of the recording in seconds as defined by sender.
+	Duration int `json:"duration"`
+
+	// MIME type of the file as defined by sender.
+	Mime string `json:"mime_type"`
+}
+
+// VideoNote object represents a round video message.
+type VideoNote struct {
+	File
+
+	// Video width and height (diameter of the video message).
+	Length int `json:"length"`
+
+	// Duration of the video in seconds as defined by sender.
+	Duration int `json:"duration"`
+
+	// Video thumbnail.
+	Preview Thumbnail `json:"thumb"`
+}
+
+// Animation object represents an animation file
+// (GIF or H.264/MPEG-4 AVC video without sound).
+type Animation struct {
+	File
+
+	Width  int `json:"width"`
+	Height int `json:"height"`
+
+	// Duration of the video in seconds as defined by sender.
+	Duration int `json:"duration"`
+
+	// Animation thumbnail as defined by sender.
+	Preview Thumbnail `json:"thumb"`
+
+	// Original filename as defined by sender.
+	FileName string `json:"file_name"`
+
+	// MIME type of the file as defined by sender.
+	Mime string `json:"mime_type"`
+}
+
+// Game object represents a game. Use BotFather to create and edit games.
+type Game struct {
+	Title       string      `json:"title"`
+	Description string      `json:"description"`
+	Photo       []Thumbnail `json:"photo"`
+
+	// (Optional) Brief description of the game or high scores included
+	// in the game message, 0-4096 characters.
+	Text     string          `json:"text"`
+	Entities []MessageEntity `json:"text_entities"`
+
+	// (Optional) Animation that will be displayed in the game message in chats.
+	Animation Animation `json:"animation"`
+}
+
+// Invoice object contains basic information about an invoice.
+type Invoice struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	// Unique bot deep-linking parameter that can be used to generate this invoice.
+	StartParameter string `json:"start_parameter"`
+
+	// Three-letter ISO 4217 currency code.
+	Currency string `json:"currency"`
+
+	// Total price in the smallest units of the currency (integer, not float/double).
+	Total int `json:"total_amount"`
+}
+
+// ShippingAddress object represents a shipping address.
+type ShippingAddress struct {
+	CountryCode string `json:"country_code"`
+	State       string `json:"state"`
+	City        string `json:"city"`
+	StreetLine1 string `json:"street_line1"`
+	StreetLine2 string `json:"street_line2"`
+	PostCode    string `json:"post_code"`
+}
+
+// OrderInfo object represents information about an order.
+type OrderInfo struct {
+	Name            string          `json:"name"`
+	PhoneNumber     string          `json:"phone_number"`
+	Email           string          `json:"email"`
+	ShippingAddress ShippingAddress `json:"shipping_address"`
+}
+
+// SuccessfulPayment object contains basic information about a successful payment.
+type SuccessfulPayment struct {
+	// Three-letter ISO 4217 currency code.
+	Currency string `json:"currency"`
+
+	// Total price in the smallest units of the currency (integer, not float/double).
+	Total int `json:"total_amount"`
+
+	// Bot specified invoice payload.
+	Payload string `json:"invoice_payload"`
+
+	// (Optional) Identifier of the shipping option chosen by the user.
+	ShippingOptionID string `json:"shipping_option_id"`
+
+	// (Optional) Order info provided by the user.
+	Order OrderInfo `json:"order_info"`
+
+	TelegramChargeID string `json:"telegram_payment_charge_id"`
+	ProviderChargeID string `json:"provider_payment_charge_id"`
+}
+
 // KeyboardButton represents a button displayed on in a message.
 type KeyboardButton struct {
 	Text        string `json:"text"`
@@ -152,6 +270,53 @@ type InlineKeyboardMarkup struct {
 	InlineKeyboard [][]KeyboardButton `json:"inline_keyboard,omitempty"`
 }
 
+// Poll object contains information about a poll.
+type Poll struct {
+	ID       string       `json:"id"`
+	Question string       `json:"question"`
+	Options  []PollOption `json:"options"`
+
+	// Total number of users that voted in the poll.
+	TotalVoters int `json:"total_voter_count"`
+
+	Closed    bool `json:"is_closed"`
+	Anonymous bool `json:"is_anonymous"`
+
+	// Poll type, currently can be "regular" or "quiz".
+	Type string `json:"type"`
+
+	MultipleAnswers bool `json:"allows_multiple_answers"`
+
+	// (Optional) 0-based identifier of the correct answer option.
+	// Available only for quizzes sent by the bot or closed quizzes.
+	CorrectOption int `json:"correct_option_id"`
+
+	// (Optional) Text that is shown when a user chooses an incorrect answer
+	// or taps on the lamp icon in a quiz-style poll.
+	Explanation         string          `json:"explanation,omitempty"`
+	ExplanationEntities []MessageEntity `json:"explanation_entities,omitempty"`
+
+	// (Optional) Amount of time in seconds the poll will be active
+	// after creation, and unixtime when the poll will be closed.
+	OpenPeriod int `json:"open_period,omitempty"`
+	CloseDate  int `json:"close_date,omitempty"`
+}
+
+// PollOption object contains information about one answer option in a poll.
+type PollOption struct {
+	Text       string `json:"text"`
+	VoterCount int    `json:"voter_count"`
+}
+
+// Dice object represents an animated emoji that displays a random value.
+type Dice struct {
+	// Emoji on which the dice throw animation is based.
+	Emoji string `json:"emoji"`
+
+	// Value of the dice, 1-6 for dice and darts, 1-5 for basketball.
+	Value int `json:"value"`
+}
+
 // Contact object represents a contact to Telegram user
 type Contact struct {
 	UserID      int    `json:"user_id"`
@@ -229,6 +394,9 @@ type MessageEntity struct {
 
 	//user	Optional. For “text_mention” only, the mentioned user
 	User User `json:"user",omitempty`
+
+	// Optional. For "pre" only, the programming language of the entity text
+	Language string `json:"language,omitempty"`
 }
 
 type UserProfilePhoto struct {
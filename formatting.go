@@ -0,0 +1,478 @@
+package telebot
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Сущности, которые задают оформление текста. Остальные (mention, url,
+// hashtag...) Telegram распознает в тексте сам.
+var formattingEntities = map[string]bool{
+	"bold":          true,
+	"italic":        true,
+	"underline":     true,
+	"strikethrough": true,
+	"spoiler":       true,
+	"code":          true,
+	"pre":           true,
+	"text_link":     true,
+	"text_mention":  true,
+}
+
+// Сущности, которые есть в устаревшем ModeMarkdown
+var markdownEntities = map[string]bool{
+	"bold":         true,
+	"italic":       true,
+	"code":         true,
+	"pre":          true,
+	"text_link":    true,
+	"text_mention": true,
+}
+
+// Render возвращает текст сообщения (или подпись медиа) с оформлением
+// из сущностей в разметке mode.
+func (m *Message) Render(mode ParseMode) string {
+	text, entities := m.entitySource()
+	return RenderEntities(text, entities, mode)
+}
+
+// RenderEntities переводит текст и его сущности в разметку mode, которую
+// можно отправить с SendOptions.ParseMode = mode.
+//
+// Вложенные сущности сохраняются, а пересекающиеся разбиваются на части.
+// В ModeMarkdown вложенность не поддерживается, поэтому остаются только
+// внешние сущности, а underline, strikethrough и spoiler теряются. Там же
+// нельзя экранировать внутри сущностей: pre с ` и ссылки с ] в тексте
+// остаются обычным текстом.
+func RenderEntities(text string, entities []MessageEntity, mode ParseMode) string {
+	if mode == ModeDefault {
+		return text
+	}
+	units := utf16.Encode([]rune(text))
+
+	var list []MessageEntity
+	for _, e := range entities {
+		if !formattingEntities[e.Type] || (mode == ModeMarkdown && !markdownEntities[e.Type]) {
+			continue
+		}
+		end := e.Offset + e.Length
+		if e.Offset < 0 {
+			e.Offset = 0
+		}
+		if end > len(units) {
+			end = len(units)
+		}
+		if e.Length = end - e.Offset; e.Length > 0 {
+			list = append(list, e)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Offset != list[j].Offset {
+			return list[i].Offset < list[j].Offset
+		}
+		return list[i].Length > list[j].Length
+	})
+	if mode == ModeMarkdown {
+		return renderMarkdown(units, outerEntities(list))
+	}
+
+	// Границы, на которых открываются и закрываются сущности
+	points := []int{0, len(units)}
+	for _, e := range list {
+		points = append(points, e.Offset, e.Offset+e.Length)
+	}
+	sort.Ints(points)
+	unique := points[:1]
+	for _, p := range points[1:] {
+		if p != unique[len(unique)-1] {
+			unique = append(unique, p)
+		}
+	}
+	points = unique
+
+	r := entityRenderer{mode: mode}
+	var stack []MessageEntity
+	next := 0
+	for i, p := range points {
+		// Закрываем сущности, которые заканчиваются здесь, вместе с
+		// открытыми после них, и заново открываем те, что продолжаются
+		for lowest, e := range stack {
+			if e.Offset+e.Length != p {
+				continue
+			}
+			for j := len(stack) - 1; j >= lowest; j-- {
+				r.close(stack[j])
+			}
+			var reopen []MessageEntity
+			for _, e := range stack[lowest+1:] {
+				if e.Offset+e.Length != p {
+					reopen = append(reopen, e)
+				}
+			}
+			stack = stack[:lowest]
+			for _, e := range reopen {
+				r.open(e)
+				stack = append(stack, e)
+			}
+			break
+		}
+
+		for next < len(list) && list[next].Offset == p {
+			r.open(list[next])
+			stack = append(stack, list[next])
+			next++
+		}
+
+		if i+1 < len(points) {
+			r.text(string(utf16.Decode(units[p:points[i+1]])), stack)
+		}
+	}
+	return r.out.String()
+}
+
+// outerEntities оставляет сущности, которые не вложены в другие и не
+// пересекаются с ними. list отсортирован по Offset.
+func outerEntities(list []MessageEntity) []MessageEntity {
+	var outer []MessageEntity
+	end := 0
+	for _, e := range list {
+		if e.Offset >= end {
+			outer = append(outer, e)
+			end = e.Offset + e.Length
+		}
+	}
+	return outer
+}
+
+// renderMarkdown переводит текст в устаревший Markdown. Сущности в list
+// не вложены друг в друга и не пересекаются.
+func renderMarkdown(units []uint16, list []MessageEntity) string {
+	r := entityRenderer{mode: ModeMarkdown}
+	pos := 0
+	for _, e := range list {
+		r.out.WriteString(EscapeMarkdown(string(utf16.Decode(units[pos:e.Offset]))))
+		r.markdownEntity(e, string(utf16.Decode(units[e.Offset:e.Offset+e.Length])))
+		pos = e.Offset + e.Length
+	}
+	r.out.WriteString(EscapeMarkdown(string(utf16.Decode(units[pos:]))))
+	return r.out.String()
+}
+
+type entityRenderer struct {
+	mode ParseMode
+	out  strings.Builder
+}
+
+func (r *entityRenderer) open(e MessageEntity) {
+	if r.mode == ModeHTML {
+		switch e.Type {
+		case "bold":
+			r.out.WriteString("<b>")
+		case "italic":
+			r.out.WriteString("<i>")
+		case "underline":
+			r.out.WriteString("<u>")
+		case "strikethrough":
+			r.out.WriteString("<s>")
+		case "spoiler":
+			r.out.WriteString("<tg-spoiler>")
+		case "code":
+			r.out.WriteString("<code>")
+		case "pre":
+			if e.Language != "" {
+				r.out.WriteString(`<pre><code class="language-` + html.EscapeString(e.Language) + `">`)
+			} else {
+				r.out.WriteString("<pre>")
+			}
+		case "text_link", "text_mention":
+			r.out.WriteString(`<a href="` + html.EscapeString(entityURL(e)) + `">`)
+		}
+		return
+	}
+
+	switch e.Type {
+	case "pre":
+		r.out.WriteString("```" + e.Language + "\n")
+	case "text_link", "text_mention":
+		r.out.WriteString("[")
+	default:
+		r.out.WriteString(markdownDelimiters[e.Type])
+	}
+}
+
+func (r *entityRenderer) close(e MessageEntity) {
+	if r.mode == ModeHTML {
+		switch e.Type {
+		case "bold":
+			r.out.WriteString("</b>")
+		case "italic":
+			r.out.WriteString("</i>")
+		case "underline":
+			r.out.WriteString("</u>")
+		case "strikethrough":
+			r.out.WriteString("</s>")
+		case "spoiler":
+			r.out.WriteString("</tg-spoiler>")
+		case "code":
+			r.out.WriteString("</code>")
+		case "pre":
+			if e.Language != "" {
+				r.out.WriteString("</code></pre>")
+			} else {
+				r.out.WriteString("</pre>")
+			}
+		case "text_link", "text_mention":
+			r.out.WriteString("</a>")
+		}
+		return
+	}
+
+	switch e.Type {
+	case "pre":
+		r.out.WriteString("```")
+	case "text_link", "text_mention":
+		url := entityURL(e)
+		if r.mode == ModeMarkdownV2 {
+			url = strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(url)
+		} else {
+			url = strings.Replace(url, ")", "%29", -1)
+		}
+		r.out.WriteString("](" + url + ")")
+	default:
+		r.out.WriteString(markdownDelimiters[e.Type])
+	}
+}
+
+// markdownEntity пишет сущность в устаревшем Markdown. Внутри сущностей он
+// не поддерживает экранирование, поэтому разделитель в тексте bold, italic
+// и code пишется экранированным между частями сущности, как советует
+// документация Bot API. У pre и ссылок такой возможности нет, и они с
+// разделителем в тексте остаются обычным текстом.
+func (r *entityRenderer) markdownEntity(e MessageEntity, s string) {
+	switch e.Type {
+	case "pre", "text_link", "text_mention":
+		delimiter := "`"
+		if e.Type != "pre" {
+			delimiter = "]"
+		}
+		if strings.Contains(s, delimiter) {
+			r.out.WriteString(EscapeMarkdown(s))
+			return
+		}
+		r.open(e)
+		r.out.WriteString(s)
+		r.close(e)
+		return
+	}
+
+	delimiter := markdownDelimiters[e.Type]
+	for i, part := range strings.Split(s, delimiter) {
+		if i > 0 {
+			r.out.WriteString(`\` + delimiter)
+		}
+		if part != "" {
+			r.open(e)
+			r.out.WriteString(part)
+			r.close(e)
+		}
+	}
+}
+
+// text пишет текст внутри сущностей stack с экранированием для режима.
+func (r *entityRenderer) text(s string, stack []MessageEntity) {
+	var inner *MessageEntity
+	if len(stack) > 0 {
+		inner = &stack[len(stack)-1]
+	}
+
+	if r.mode == ModeHTML {
+		r.out.WriteString(EscapeHTML(s))
+	} else if inner != nil && (inner.Type == "code" || inner.Type == "pre") {
+		r.out.WriteString(strings.NewReplacer(`\`, `\\`, "`", "\\`").Replace(s))
+	} else {
+		r.out.WriteString(EscapeMarkdownV2(s))
+	}
+}
+
+// Разделители сущностей в ModeMarkdown и ModeMarkdownV2
+var markdownDelimiters = map[string]string{
+	"bold":          "*",
+	"italic":        "_",
+	"underline":     "__",
+	"strikethrough": "~",
+	"spoiler":       "||",
+	"code":          "`",
+}
+
+func entityURL(e MessageEntity) string {
+	if e.Type == "text_mention" {
+		return "tg://user?id=" + strconv.Itoa(e.User.ID)
+	}
+	return e.Url
+}
+
+// EscapeHTML экранирует текст для ModeHTML.
+func EscapeHTML(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// EscapeMarkdownV2 экранирует текст для ModeMarkdownV2.
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Escaper.Replace(s)
+}
+
+var markdownEscaper = strings.NewReplacer("_", `\_`, "*", `\*`, "`", "\\`", "[", `\[`)
+
+// EscapeMarkdown экранирует текст вне сущностей для ModeMarkdown.
+func EscapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+var htmlAttribute = regexp.MustCompile(`([a-zA-Z][\w-]*)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+// ParseHTML переводит текст в HTML-разметке Telegram в обычный текст и
+// сущности, которые можно отправить в SendOptions.Entities без ParseMode.
+// Поддерживаются теги b, strong, i, em, u, ins, s, strike, del,
+// tg-spoiler, span class="tg-spoiler", code, pre, pre с вложенным
+// code class="language-...", и a href, в том числе tg://user?id=.
+func ParseHTML(s string) (string, []MessageEntity, error) {
+	type openTag struct {
+		name   string
+		entity MessageEntity
+		// code внутри pre задает язык и не создает отдельной сущности
+		merged bool
+	}
+
+	var (
+		text     strings.Builder
+		offset   int
+		stack    []openTag
+		entities []MessageEntity
+	)
+	write := func(s string) {
+		text.WriteString(s)
+		offset += utf16Len(s)
+	}
+
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '<':
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				return "", nil, fmt.Errorf("telebot: unclosed tag at byte %d", i)
+			}
+			tag := strings.TrimSpace(s[i+1 : i+end])
+			i += end + 1
+
+			if strings.HasPrefix(tag, "/") {
+				name := strings.ToLower(strings.TrimSpace(tag[1:]))
+				if len(stack) == 0 || stack[len(stack)-1].name != name {
+					return "", nil, fmt.Errorf("telebot: unexpected end tag </%s>", name)
+				}
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if top.merged {
+					continue
+				}
+				if top.entity.Length = offset - top.entity.Offset; top.entity.Length > 0 {
+					entities = append(entities, top.entity)
+				}
+				continue
+			}
+
+			name := tag
+			if n := strings.IndexAny(tag, " \t\n"); n >= 0 {
+				name = tag[:n]
+			}
+			name = strings.ToLower(name)
+			attrs := make(map[string]string)
+			for _, m := range htmlAttribute.FindAllStringSubmatch(tag[len(name):], -1) {
+				attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3])
+			}
+
+			open := openTag{name: name, entity: MessageEntity{Offset: offset}}
+			switch name {
+			case "b", "strong":
+				open.entity.Type = "bold"
+			case "i", "em":
+				open.entity.Type = "italic"
+			case "u", "ins":
+				open.entity.Type = "underline"
+			case "s", "strike", "del":
+				open.entity.Type = "strikethrough"
+			case "tg-spoiler":
+				open.entity.Type = "spoiler"
+			case "span":
+				if attrs["class"] != "tg-spoiler" {
+					return "", nil, fmt.Errorf("telebot: unsupported tag <%s>", tag)
+				}
+				open.entity.Type = "spoiler"
+			case "pre":
+				open.entity.Type = "pre"
+			case "code":
+				open.entity.Type = "code"
+				language := strings.TrimPrefix(attrs["class"], "language-")
+				if n := len(stack); n > 0 && stack[n-1].name == "pre" && stack[n-1].entity.Offset == offset {
+					stack[n-1].entity.Language = language
+					open.merged = true
+				}
+			case "a":
+				href := attrs["href"]
+				if id := strings.TrimPrefix(href, "tg://user?id="); id != href {
+					userID, err := strconv.Atoi(id)
+					if err != nil {
+						return "", nil, fmt.Errorf("telebot: bad user link '%s'", href)
+					}
+					open.entity.Type = "text_mention"
+					open.entity.User = User{ID: userID}
+				} else {
+					open.entity.Type = "text_link"
+					open.entity.Url = href
+				}
+			default:
+				return "", nil, fmt.Errorf("telebot: unsupported tag <%s>", name)
+			}
+			stack = append(stack, open)
+
+		case '&':
+			end := strings.IndexByte(s[i:], ';')
+			if end < 0 || end > 10 {
+				write("&")
+				i++
+				continue
+			}
+			write(html.UnescapeString(s[i : i+end+1]))
+			i += end + 1
+
+		default:
+			end := strings.IndexAny(s[i:], "<&")
+			if end < 0 {
+				end = len(s) - i
+			}
+			write(s[i : i+end])
+			i += end
+		}
+	}
+	if len(stack) > 0 {
+		return "", nil, fmt.Errorf("telebot: unclosed tag <%s>", stack[len(stack)-1].name)
+	}
+
+	sort.SliceStable(entities, func(i, j int) bool {
+		if entities[i].Offset != entities[j].Offset {
+			return entities[i].Offset < entities[j].Offset
+		}
+		return entities[i].Length > entities[j].Length
+	})
+	return text.String(), entities, nil
+}
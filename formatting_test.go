@@ -0,0 +1,93 @@
+package telebot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRenderEntities(t *testing.T) {
+	// "Жирный курсив 👍 <ссылка>": курсив вложен в жирный, ссылка
+	// пересекается с жирным
+	text := "Жирный курсив 👍 <ссылка>"
+	entities := []MessageEntity{
+		{Type: "bold", Offset: 0, Length: 13},
+		{Type: "italic", Offset: 7, Length: 6},
+		{Type: "text_link", Offset: 10, Length: 15, Url: "https://example.com/?a=1&b=2"},
+		{Type: "hashtag", Offset: 0, Length: 6},
+	}
+
+	cases := map[ParseMode]string{
+		ModeDefault: text,
+		ModeHTML: `<b>Жирный <i>кур<a href="https://example.com/?a=1&amp;b=2">сив</a></i></b>` +
+			`<a href="https://example.com/?a=1&amp;b=2"> 👍 &lt;ссылка&gt;</a>`,
+		ModeMarkdownV2: `*Жирный _кур[сив](https://example.com/?a=1&b=2)_*[ 👍 <ссылка\>](https://example.com/?a=1&b=2)`,
+		ModeMarkdown:   `*Жирный курсив* 👍 <ссылка>`,
+	}
+	for mode, expected := range cases {
+		if got := RenderEntities(text, entities, mode); got != expected {
+			t.Errorf("%q: expected\n%s\ngot\n%s", mode, expected, got)
+		}
+	}
+
+	m := Message{
+		Caption: "a_b *c* [d]",
+		CaptionEntities: []MessageEntity{
+			{Type: "bold", Offset: 4, Length: 3},
+			{Type: "pre", Offset: 8, Length: 3, Language: "go"},
+		},
+	}
+	// Устаревший Markdown не экранирует внутри сущностей: разделитель
+	// пишется между частями сущности
+	if got := m.Render(ModeMarkdown); got != "a\\_b \\**c*\\* ```go\n[d]```" {
+		t.Errorf("Markdown: got %q", got)
+	}
+	if got := m.Render(ModeMarkdownV2); got != "a\\_b *\\*c\\** ```go\n[d]```" {
+		t.Errorf("MarkdownV2: got %q", got)
+	}
+	if got := m.Render(ModeHTML); got != `a_b <b>*c*</b> <pre><code class="language-go">[d]</code></pre>` {
+		t.Errorf("HTML: got %q", got)
+	}
+
+	m.CaptionEntities = []MessageEntity{
+		{Type: "text_link", Offset: 0, Length: 3, Url: "https://example.com"},
+		{Type: "pre", Offset: 8, Length: 3},
+	}
+	m.Caption = "a]b *c* `d`"
+	if got := m.Render(ModeMarkdown); got != "a]b \\*c\\* \\`d\\`" {
+		t.Errorf("Markdown links and pre with delimiters must stay plain: got %q", got)
+	}
+}
+
+func TestParseHTML(t *testing.T) {
+	text, entities, err := ParseHTML(`<b>Жирный <i>курсив</i></b> 👍 &lt;<a href="tg://user?id=42">Иван</a>&gt; ` +
+		`<span class="tg-spoiler">тайна</span> <pre><code class="language-go">x &amp;&amp; y</code></pre>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Жирный курсив 👍 <Иван> тайна x && y" {
+		t.Fatalf("Wrong text %q", text)
+	}
+	expected := []MessageEntity{
+		{Type: "bold", Offset: 0, Length: 13},
+		{Type: "italic", Offset: 7, Length: 6},
+		{Type: "text_mention", Offset: 18, Length: 4, User: User{ID: 42}},
+		{Type: "spoiler", Offset: 24, Length: 5},
+		{Type: "pre", Offset: 30, Length: 6, Language: "go"},
+	}
+	if !reflect.DeepEqual(entities, expected) {
+		t.Fatalf("Expected %v, got %v", expected, entities)
+	}
+
+	// Разбор и отрисовка сохраняют разметку
+	source := `<b>a <i>b</i></b><i> c</i> <a href="https://example.com">d</a>`
+	text, entities, _ = ParseHTML(source)
+	if html := RenderEntities(text, entities, ModeHTML); html != source {
+		t.Fatalf("Expected %s, got %s", source, html)
+	}
+
+	for _, bad := range []string{"<b>a", "<b>a</i>", "<script>x</script>", "a</b>", "<b"} {
+		if _, _, err := ParseHTML(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,467 @@
+package telebot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PluralRule возвращает категорию множественного числа по CLDR
+// ("zero", "one", "two", "few", "many", "other") для числа n.
+type PluralRule func(n int) string
+
+var (
+	pluralRulesMu sync.RWMutex
+	pluralRules   = map[string]PluralRule{
+		"en": pluralOneOther,
+		"de": pluralOneOther,
+		"es": pluralOneOther,
+		"it": pluralOneOther,
+		"nl": pluralOneOther,
+		"pt": pluralOneOther,
+		"fr": pluralFrench,
+		"ru": pluralEastSlavic,
+		"uk": pluralEastSlavic,
+		"be": pluralEastSlavic,
+		"pl": pluralPolish,
+		"cs": pluralCzech,
+		"sk": pluralCzech,
+		"ja": pluralOther,
+		"ko": pluralOther,
+		"zh": pluralOther,
+		"tr": pluralOther,
+		"id": pluralOther,
+		"fa": pluralOther,
+	}
+)
+
+var pluralCategories = map[string]bool{
+	"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true,
+}
+
+// RegisterPluralRule задает правило множественного числа для языка,
+// например "ar". Язык указывается без региона.
+func RegisterPluralRule(lang string, rule PluralRule) {
+	pluralRulesMu.Lock()
+	defer pluralRulesMu.Unlock()
+	pluralRules[normalizeLocale(lang)] = rule
+}
+
+func pluralOther(n int) string {
+	return "other"
+}
+
+func pluralOneOther(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralFrench(n int) string {
+	if n == 0 || n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func pluralEastSlavic(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+func pluralPolish(n int) string {
+	if n < 0 {
+		n = -n
+	}
+	switch {
+	case n == 1:
+		return "one"
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return "few"
+	}
+	return "many"
+}
+
+func pluralCzech(n int) string {
+	switch {
+	case n == 1:
+		return "one"
+	case n >= 2 && n <= 4:
+		return "few"
+	}
+	return "other"
+}
+
+// LanguageStore хранит язык, выбранный пользователем вручную.
+// Language возвращает пустую строку, если пользователь язык не выбирал.
+type LanguageStore interface {
+	Language(userID int) (string, error)
+	SetLanguage(userID int, locale string) error
+}
+
+// MemoryLanguageStore - LanguageStore в памяти процесса.
+type MemoryLanguageStore struct {
+	mu        sync.RWMutex
+	languages map[int]string
+}
+
+func NewMemoryLanguageStore() *MemoryLanguageStore {
+	return &MemoryLanguageStore{languages: make(map[int]string)}
+}
+
+func (s *MemoryLanguageStore) Language(userID int) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.languages[userID], nil
+}
+
+func (s *MemoryLanguageStore) SetLanguage(userID int, locale string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if locale == "" {
+		delete(s.languages, userID)
+	} else {
+		s.languages[userID] = locale
+	}
+	return nil
+}
+
+// i18nMessage - строка каталога: простая или с формами множественного числа.
+type i18nMessage struct {
+	text   string
+	plural map[string]string
+}
+
+// I18n хранит каталоги сообщений по локалям и выдает переводчики,
+// привязанные к языку пользователя.
+//
+// Язык пользователя определяется так: выбранный вручную в Store,
+// затем User.LanguageCode, затем DefaultLocale. Для локали "pt-br"
+// при отсутствии строки проверяется "pt", затем DefaultLocale.
+type I18n struct {
+	DefaultLocale string
+	Store         LanguageStore
+
+	mu       sync.RWMutex
+	catalogs map[string]map[string]i18nMessage
+}
+
+// NewI18n создает пустой набор каталогов. store может быть nil.
+func NewI18n(defaultLocale string, store LanguageStore) *I18n {
+	return &I18n{
+		DefaultLocale: normalizeLocale(defaultLocale),
+		Store:         store,
+		catalogs:      make(map[string]map[string]i18nMessage),
+	}
+}
+
+// LoadDir загружает все файлы *.json из каталога dir.
+// Имя файла без расширения задает локаль: "ru.json", "pt-BR.json".
+func (i *I18n) LoadDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.ToLower(filepath.Ext(f.Name())) != ".json" {
+			continue
+		}
+		if err := i.LoadFile(filepath.Join(dir, f.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFile загружает каталог из JSON файла. Локаль берется из имени файла.
+// Каталоги в других форматах можно разобрать самостоятельно и передать в Add.
+//
+// Значение ключа - строка в формате fmt или объект с формами множественного
+// числа ("one", "few", "many", "other", ...). Вложенные объекты задают
+// пространства имен: ключ "menu": {"start": "..."} доступен как "menu.start".
+func (i *I18n) LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var raw map[string]interface{}
+	if strings.ToLower(filepath.Ext(path)) != ".json" {
+		return fmt.Errorf("telebot: unsupported catalog format '%s'", path)
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("telebot: can't parse catalog '%s': %s", path, err)
+	}
+
+	locale := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return i.Add(locale, raw)
+}
+
+// Add добавляет строки в каталог локали, перезаписывая существующие ключи.
+func (i *I18n) Add(locale string, messages map[string]interface{}) error {
+	parsed := make(map[string]i18nMessage)
+	if err := flattenCatalog("", messages, parsed); err != nil {
+		return err
+	}
+
+	locale = normalizeLocale(locale)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.catalogs == nil {
+		i.catalogs = make(map[string]map[string]i18nMessage)
+	}
+	catalog, ok := i.catalogs[locale]
+	if !ok {
+		catalog = make(map[string]i18nMessage)
+		i.catalogs[locale] = catalog
+	}
+	for key, msg := range parsed {
+		catalog[key] = msg
+	}
+	return nil
+}
+
+func flattenCatalog(prefix string, raw map[string]interface{}, out map[string]i18nMessage) error {
+	for key, value := range raw {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case string:
+			out[key] = i18nMessage{text: v}
+		case map[string]interface{}:
+			if err := flattenMap(key, v, out); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("telebot: catalog key '%s' must be a string or an object", key)
+		}
+	}
+	return nil
+}
+
+// flattenMap разбирает объект: формы множественного числа или пространство имен.
+func flattenMap(key string, m map[string]interface{}, out map[string]i18nMessage) error {
+	plural := make(map[string]string, len(m))
+	for category, value := range m {
+		text, isString := value.(string)
+		if !pluralCategories[category] || !isString {
+			return flattenCatalog(key, m, out)
+		}
+		plural[category] = text
+	}
+	out[key] = i18nMessage{plural: plural}
+	return nil
+}
+
+// Locales возвращает список загруженных локалей.
+func (i *I18n) Locales() []string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	locales := make([]string, 0, len(i.catalogs))
+	for locale := range i.catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// SetLanguage сохраняет язык, выбранный пользователем. Пустая строка
+// возвращает язык из настроек Telegram.
+func (i *I18n) SetLanguage(userID int, locale string) error {
+	if i.Store == nil {
+		return fmt.Errorf("telebot: i18n has no language store")
+	}
+	return i.Store.SetLanguage(userID, normalizeLocale(locale))
+}
+
+// Locale возвращает локаль пользователя.
+func (i *I18n) Locale(u User) string {
+	if i.Store != nil && u.ID != 0 {
+		if locale, err := i.Store.Language(u.ID); err == nil && locale != "" {
+			return normalizeLocale(locale)
+		}
+	}
+	if u.LanguageCode != "" {
+		return normalizeLocale(u.LanguageCode)
+	}
+	return i.DefaultLocale
+}
+
+// For возвращает переводчик для пользователя.
+func (i *I18n) For(u User) *Translator {
+	return i.ForLocale(i.Locale(u))
+}
+
+// ForMessage возвращает переводчик для отправителя сообщения.
+func (i *I18n) ForMessage(m Message) *Translator {
+	return i.For(m.Sender)
+}
+
+// ForCallback возвращает переводчик для пользователя, нажавшего кнопку.
+func (i *I18n) ForCallback(c Callback) *Translator {
+	return i.For(c.Sender)
+}
+
+// ForLocale возвращает переводчик для заданной локали.
+func (i *I18n) ForLocale(locale string) *Translator {
+	return &Translator{Locale: normalizeLocale(locale), i18n: i}
+}
+
+// lookup ищет строку в локали, базовом языке и локали по умолчанию.
+// Возвращает также язык, по правилам которого нужно склонять.
+func (i *I18n) lookup(locale, key string) (i18nMessage, string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	for _, l := range []string{locale, baseLanguage(locale), i.DefaultLocale, baseLanguage(i.DefaultLocale)} {
+		if msg, ok := i.catalogs[l][key]; ok {
+			return msg, l, true
+		}
+	}
+	return i18nMessage{}, "", false
+}
+
+// Translator переводит строки на язык конкретного пользователя.
+type Translator struct {
+	Locale string
+
+	i18n *I18n
+}
+
+// T возвращает перевод строки key, отформатированный через fmt.Sprintf с args.
+//
+// Для строк с формами множественного числа форма выбирается по первому
+// аргументу, который должен быть целым числом. Без такого аргумента
+// используется форма "other". Если ключ не найден ни в одной локали или
+// нужной формы нет, а формы "other" тоже нет (в русском каталоге обычно
+// только "one", "few" и "many"), возвращается сам ключ.
+func (t *Translator) T(key string, args ...interface{}) string {
+	msg, locale, ok := t.i18n.lookup(t.Locale, key)
+	if !ok {
+		return key
+	}
+
+	text := msg.text
+	if msg.plural != nil {
+		var found bool
+		text, found = msg.plural["other"]
+		if len(args) > 0 {
+			if n, isInt := pluralCount(args[0]); isInt {
+				if form, exists := msg.plural[PluralCategory(locale, n)]; exists {
+					text, found = form, true
+				}
+			}
+		}
+		if !found {
+			return key
+		}
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Button возвращает inline кнопку с переведенной надписью.
+func (t *Translator) Button(key, data string, args ...interface{}) KeyboardButton {
+	return KeyboardButton{Text: t.T(key, args...), Data: data}
+}
+
+// InlineKeyboard возвращает копию клавиатуры, в которой надписи кнопок
+// считаются ключами каталога и заменены переводами.
+func (t *Translator) InlineKeyboard(rows [][]KeyboardButton) [][]KeyboardButton {
+	result := make([][]KeyboardButton, len(rows))
+	for r, row := range rows {
+		result[r] = make([]KeyboardButton, len(row))
+		for c, button := range row {
+			button.Text = t.T(button.Text)
+			result[r][c] = button
+		}
+	}
+	return result
+}
+
+// Keyboard делает то же, что InlineKeyboard, для обычной клавиатуры.
+func (t *Translator) Keyboard(rows [][]SimpleKeyboardButton) [][]SimpleKeyboardButton {
+	result := make([][]SimpleKeyboardButton, len(rows))
+	for r, row := range rows {
+		result[r] = make([]SimpleKeyboardButton, len(row))
+		for c, button := range row {
+			button.Text = t.T(button.Text)
+			result[r][c] = button
+		}
+	}
+	return result
+}
+
+// PluralCategory возвращает категорию множественного числа для локали.
+// Для языков без зарегистрированного правила используется правило английского.
+func PluralCategory(locale string, n int) string {
+	pluralRulesMu.RLock()
+	rule, ok := pluralRules[baseLanguage(locale)]
+	pluralRulesMu.RUnlock()
+	if ok {
+		return rule(n)
+	}
+	return pluralOneOther(n)
+}
+
+func pluralCount(arg interface{}) (int, bool) {
+	switch n := arg.(type) {
+	case int:
+		return n, true
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint:
+		return int(n), true
+	case uint8:
+		return int(n), true
+	case uint16:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	}
+	return 0, false
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(locale, "_", "-", -1))
+}
+
+func baseLanguage(locale string) string {
+	if i := strings.Index(locale, "-"); i > 0 {
+		return locale[:i]
+	}
+	return locale
+}
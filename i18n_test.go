@@ -0,0 +1,76 @@
+package telebot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestI18n(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-i18n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "en.json"), []byte(`{
+		"hello": "Hello, %s!",
+		"apples": {"one": "%d apple", "other": "%d apples"},
+		"menu": {"start": "Start"}
+	}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "ru.json"), []byte(`{
+		"hello": "Привет, %s!",
+		"apples": {"one": "%d яблоко", "few": "%d яблока", "many": "%d яблок"}
+	}`), 0644)
+	// Другие форматы LoadDir пропускает
+	ioutil.WriteFile(filepath.Join(dir, "de.yaml"), []byte("hello: Hallo, %s!\n"), 0644)
+
+	i18n := NewI18n("en", NewMemoryLanguageStore())
+	if err := i18n.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	ru := i18n.For(User{ID: 1, LanguageCode: "ru-RU"})
+	if ru.T("hello", "Вася") != "Привет, Вася!" {
+		t.Fatal("Can't translate by user language code:", ru.T("hello", "Вася"))
+	}
+	if ru.T("apples", 22) != "22 яблока" || ru.T("apples", 11) != "11 яблок" || ru.T("apples", 21) != "21 яблоко" {
+		t.Fatal("Wrong russian plural forms.")
+	}
+	if ru.T("apples") != "apples" {
+		t.Fatal("Plural entry without the other form must fall back to the key:", ru.T("apples"))
+	}
+	if ru.T("menu.start") != "Start" {
+		t.Fatal("Missing keys must fall back to the default locale.")
+	}
+	if ru.T("missing") != "missing" {
+		t.Fatal("Unknown keys must be returned as is.")
+	}
+
+	// Правила можно регистрировать во время работы
+	done := make(chan struct{})
+	go func() {
+		RegisterPluralRule("ar", pluralOther)
+		close(done)
+	}()
+	ru.T("apples", 5)
+	<-done
+
+	i18n.SetLanguage(1, "en")
+	en := i18n.For(User{ID: 1, LanguageCode: "ru"})
+	if en.T("apples", 1) != "1 apple" {
+		t.Fatal("Stored language override must win over language code.")
+	}
+	if en.T("apples") != "%d apples" {
+		t.Fatal("Plural entry without a count must use the other form:", en.T("apples"))
+	}
+	if locales := i18n.Locales(); len(locales) != 2 {
+		t.Fatal("Only JSON catalogs must be loaded:", locales)
+	}
+
+	keyboard := en.InlineKeyboard([][]KeyboardButton{{{Text: "menu.start", Data: "start"}}})
+	if keyboard[0][0].Text != "Start" || keyboard[0][0].Data != "start" {
+		t.Fatal("Can't localize keyboard.")
+	}
+}
@@ -0,0 +1,258 @@
+package telebot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FloodPolicy определяет, что делать с пользователем, превысившим лимит.
+type FloodPolicy int
+
+const (
+	// FloodDrop молча отбрасывает лишние сообщения.
+	FloodDrop FloodPolicy = iota
+	// FloodNotify отбрасывает лишние сообщения и один раз отвечает
+	// пользователю уведомлением с временем ожидания.
+	FloodNotify
+	// FloodMute на время MuteFor игнорирует все сообщения пользователя.
+	FloodMute
+)
+
+// DefaultFloodNotice - текст уведомления по умолчанию, %d - секунды ожидания.
+const DefaultFloodNotice = "Too many requests, please try again in %d s."
+
+// IncomingLimiter ограничивает частоту входящих сообщений и нажатий
+// inline кнопок до того, как они попадут в Messages и Callbacks.
+// Корзины токенов ведутся отдельно для каждого пользователя и каждого чата.
+type IncomingLimiter struct {
+	// Лимит на пользователя по всем сообщениям.
+	PerUser Limit
+
+	// Лимит на чат по всем сообщениям.
+	PerChat Limit
+
+	// Дополнительные лимиты на пользователя для отдельных команд.
+	// Ключ - команда вида "/report". Для callback ключом служит
+	// начало Data до первого пробела или двоеточия.
+	Commands map[string]Limit
+
+	Policy FloodPolicy
+
+	// Текст уведомления для FloodNotify, %d - секунды ожидания.
+	Notice string
+
+	// Длительность мьюта для FloodMute.
+	MuteFor time.Duration
+
+	mu        sync.Mutex
+	users     map[string]*tokenBucket
+	chats     map[string]*tokenBucket
+	commands  map[string]*tokenBucket
+	notified  map[int]time.Time
+	muted     map[int]time.Time
+	lastSweep time.Time
+}
+
+// NewIncomingLimiter создает ограничитель с лимитами на пользователя и чат.
+// Нулевой Limit отключает соответствующую проверку.
+func NewIncomingLimiter(perUser, perChat Limit, policy FloodPolicy) *IncomingLimiter {
+	return &IncomingLimiter{
+		PerUser: perUser,
+		PerChat: perChat,
+		Policy:  policy,
+		Notice:  DefaultFloodNotice,
+		MuteFor: time.Minute,
+	}
+}
+
+// Mute запрещает пользователю отправлять сообщения боту на время d.
+func (l *IncomingLimiter) Mute(userID int, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	l.muted[userID] = time.Now().Add(d)
+}
+
+// Unmute снимает мьют с пользователя.
+func (l *IncomingLimiter) Unmute(userID int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.muted, userID)
+}
+
+func (l *IncomingLimiter) init() {
+	if l.users == nil {
+		l.users = make(map[string]*tokenBucket)
+		l.chats = make(map[string]*tokenBucket)
+		l.commands = make(map[string]*tokenBucket)
+		l.notified = make(map[int]time.Time)
+		l.muted = make(map[int]time.Time)
+	}
+}
+
+// allow проверяет все корзины и возвращает время ожидания, если
+// сообщение нужно отбросить. notify будет true только для первого
+// отброшенного сообщения в серии.
+func (l *IncomingLimiter) allow(userID int, chatID, command string, now time.Time) (ok bool, cooldown time.Duration, notify bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.init()
+	l.sweep(now)
+
+	if until, muted := l.muted[userID]; muted {
+		if now.Before(until) {
+			return false, until.Sub(now), false
+		}
+		delete(l.muted, userID)
+	}
+
+	var buckets []*tokenBucket
+	if !l.PerUser.IsZero() && userID != 0 {
+		buckets = append(buckets, bucketFor(l.users, strconv.Itoa(userID), l.PerUser, now))
+	}
+	if !l.PerChat.IsZero() && chatID != "" && chatID != "0" {
+		buckets = append(buckets, bucketFor(l.chats, chatID, l.PerChat, now))
+	}
+	if limit, exists := l.Commands[command]; exists && command != "" && !limit.IsZero() {
+		key := strconv.Itoa(userID) + " " + command
+		buckets = append(buckets, bucketFor(l.commands, key, limit, now))
+	}
+
+	// Сначала убеждаемся, что токены есть во всех корзинах, чтобы
+	// отброшенное сообщение не расходовало лимит остальных.
+	for _, tb := range buckets {
+		if d := tb.delay(now); d > cooldown {
+			cooldown = d
+		}
+	}
+	if cooldown == 0 {
+		for _, tb := range buckets {
+			tb.take(now)
+		}
+		return true, 0, false
+	}
+
+	switch l.Policy {
+	case FloodMute:
+		if userID != 0 {
+			cooldown = l.MuteFor
+			l.muted[userID] = now.Add(cooldown)
+		}
+	case FloodNotify:
+		if until, exists := l.notified[userID]; !exists || !now.Before(until) {
+			l.notified[userID] = now.Add(cooldown)
+			notify = true
+		}
+	}
+
+	return false, cooldown, notify
+}
+
+// sweep раз в минуту удаляет неиспользуемые корзины и истекшие отметки.
+func (l *IncomingLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for k, tb := range l.users {
+		if tb.full(now) {
+			delete(l.users, k)
+		}
+	}
+	for k, tb := range l.chats {
+		if tb.full(now) {
+			delete(l.chats, k)
+		}
+	}
+	for k, tb := range l.commands {
+		if tb.full(now) {
+			delete(l.commands, k)
+		}
+	}
+	for k, until := range l.notified {
+		if !now.Before(until) {
+			delete(l.notified, k)
+		}
+	}
+	for k, until := range l.muted {
+		if !now.Before(until) {
+			delete(l.muted, k)
+		}
+	}
+}
+
+func bucketFor(buckets map[string]*tokenBucket, key string, limit Limit, now time.Time) *tokenBucket {
+	tb, ok := buckets[key]
+	if !ok {
+		tb = newTokenBucket(limit, now)
+		buckets[key] = tb
+	}
+	return tb
+}
+
+// admit решает, передавать ли обновление дальше, и при необходимости
+// уведомляет пользователя о превышении лимита.
+func (l *IncomingLimiter) admit(b *Bot, update Update) bool {
+	now := time.Now()
+
+	if update.Payload != nil {
+		m := update.Payload
+		ok, cooldown, notify := l.allow(m.Sender.ID, m.Chat.Destination(), messageCommand(m.Text), now)
+		if notify {
+			go b.SendMessage(m.Chat, l.noticeText(cooldown), &SendOptions{ReplyTo: *m})
+		}
+		return ok
+	}
+
+	if update.Callback != nil {
+		c := update.Callback
+		ok, cooldown, notify := l.allow(c.Sender.ID, c.Message.Chat.Destination(), callbackCommand(c.Data), now)
+		if !ok {
+			// На callback нужно ответить в любом случае, иначе у
+			// пользователя будут крутиться часики на кнопке.
+			response := &CallbackResponse{}
+			if notify {
+				response.Text = l.noticeText(cooldown)
+			}
+			go b.AnswerCallbackQuery(c, response)
+		}
+		return ok
+	}
+
+	return true
+}
+
+func (l *IncomingLimiter) noticeText(cooldown time.Duration) string {
+	notice := l.Notice
+	if notice == "" {
+		notice = DefaultFloodNotice
+	}
+	seconds := int((cooldown + time.Second - 1) / time.Second)
+	if !strings.Contains(notice, "%d") {
+		return notice
+	}
+	return fmt.Sprintf(notice, seconds)
+}
+
+// messageCommand возвращает команду из текста сообщения без @имени бота.
+func messageCommand(text string) string {
+	if !strings.HasPrefix(text, "/") {
+		return ""
+	}
+	command := strings.Fields(text)[0]
+	if i := strings.Index(command, "@"); i > 0 {
+		command = command[:i]
+	}
+	return command
+}
+
+func callbackCommand(data string) string {
+	if i := strings.IndexAny(data, " :"); i >= 0 {
+		return data[:i]
+	}
+	return data
+}
@@ -0,0 +1,54 @@
+package telebot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIncomingLimiter(t *testing.T) {
+	l := NewIncomingLimiter(Limit{Count: 2, Per: time.Second}, Limit{}, FloodNotify)
+	l.Commands = map[string]Limit{"/report": {Count: 1, Per: time.Minute}}
+	now := time.Now()
+
+	if ok, _, _ := l.allow(1, "1", "/report", now); !ok {
+		t.Fatal("First command must pass.")
+	}
+
+	ok, cooldown, notify := l.allow(1, "1", "/report", now)
+	if ok || !notify || cooldown <= time.Second {
+		t.Fatal("Second /report must be dropped with a notice and command cooldown.")
+	}
+
+	if _, _, notify := l.allow(1, "1", "/report", now); notify {
+		t.Fatal("Notice must be sent only once per cooldown.")
+	}
+
+	// Dropped messages don't spend the per-user budget.
+	if ok, _, _ := l.allow(1, "1", "hello", now); !ok {
+		t.Fatal("Plain message must pass the per-user limit.")
+	}
+	if ok, _, _ := l.allow(1, "1", "hello", now); ok {
+		t.Fatal("Per-user limit must be enforced.")
+	}
+	if ok, _, _ := l.allow(1, "1", "hello", now.Add(time.Second)); !ok {
+		t.Fatal("Bucket must refill over time.")
+	}
+
+	l.Policy = FloodMute
+	l.MuteFor = time.Hour
+	l.allow(2, "2", "", now)
+	l.allow(2, "2", "", now)
+	l.allow(2, "2", "", now)
+	if ok, _, _ := l.allow(2, "2", "", now.Add(time.Minute)); ok {
+		t.Fatal("Muted user must be ignored.")
+	}
+}
+
+func TestMessageCommand(t *testing.T) {
+	if messageCommand("/report@my_bot now") != "/report" {
+		t.Fatal("Can't extract command addressed to a bot.")
+	}
+	if messageCommand("report") != "" {
+		t.Fatal("Plain text is not a command.")
+	}
+}
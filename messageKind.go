@@ -0,0 +1,164 @@
+package telebot
+
+import "strings"
+
+// MessageKind - вид сообщения: содержимое или служебное событие.
+type MessageKind int
+
+const (
+	KindUnknown MessageKind = iota
+	KindText
+	// Текст, начинающийся с команды боту, например "/start"
+	KindCommand
+	KindPhoto
+	KindVideo
+	KindVideoNote
+	KindVoice
+	KindAudio
+	KindDocument
+	KindAnimation
+	KindSticker
+	KindLocation
+	KindVenue
+	KindContact
+	KindGame
+	KindInvoice
+	KindPoll
+	KindDice
+
+	// Служебные события
+	KindMembersJoined
+	KindMemberLeft
+	KindTitleChanged
+	KindPhotoChanged
+	KindPhotoDeleted
+	KindGroupCreated
+	KindSuperGroupCreated
+	KindChannelCreated
+	// Группа преобразована в супергруппу: сообщение в старой группе
+	KindMigratedTo
+	// Группа преобразована в супергруппу: сообщение в новой супергруппе
+	KindMigratedFrom
+	KindPinned
+	KindPayment
+)
+
+var messageKindNames = map[MessageKind]string{
+	KindUnknown:           "unknown",
+	KindText:              "text",
+	KindCommand:           "command",
+	KindPhoto:             "photo",
+	KindVideo:             "video",
+	KindVideoNote:         "video_note",
+	KindVoice:             "voice",
+	KindAudio:             "audio",
+	KindDocument:          "document",
+	KindAnimation:         "animation",
+	KindSticker:           "sticker",
+	KindLocation:          "location",
+	KindVenue:             "venue",
+	KindContact:           "contact",
+	KindGame:              "game",
+	KindInvoice:           "invoice",
+	KindPoll:              "poll",
+	KindDice:              "dice",
+	KindMembersJoined:     "members_joined",
+	KindMemberLeft:        "member_left",
+	KindTitleChanged:      "title_changed",
+	KindPhotoChanged:      "photo_changed",
+	KindPhotoDeleted:      "photo_deleted",
+	KindGroupCreated:      "group_created",
+	KindSuperGroupCreated: "supergroup_created",
+	KindChannelCreated:    "channel_created",
+	KindMigratedTo:        "migrated_to",
+	KindMigratedFrom:      "migrated_from",
+	KindPinned:            "pinned",
+	KindPayment:           "payment",
+}
+
+func (k MessageKind) String() string {
+	return messageKindNames[k]
+}
+
+// IsService говорит, что это служебное событие, а не содержимое.
+func (k MessageKind) IsService() bool {
+	return k >= KindMembersJoined
+}
+
+// Kind определяет вид сообщения. Сообщение с несколькими видами
+// содержимого (например, анимация дублируется в Document) получает
+// наиболее конкретный вид.
+func (m *Message) Kind() MessageKind {
+	switch {
+	case len(m.UsersJoined) > 0 || m.UserJoined != User{}:
+		return KindMembersJoined
+	case m.UserLeft != User{}:
+		return KindMemberLeft
+	case m.NewChatTitle != "":
+		return KindTitleChanged
+	case len(m.NewChatPhoto) > 0:
+		return KindPhotoChanged
+	case m.ChatPhotoDeleted:
+		return KindPhotoDeleted
+	case m.ChatCreated:
+		return KindGroupCreated
+	case m.SuperGroupCreated:
+		return KindSuperGroupCreated
+	case m.ChannelCreated:
+		return KindChannelCreated
+	case m.MigrateTo != 0:
+		return KindMigratedTo
+	case m.MigrateFrom != 0:
+		return KindMigratedFrom
+	case m.PinnedMessage != nil:
+		return KindPinned
+	case m.Payment.Payload != "" || m.Payment.TelegramChargeID != "":
+		return KindPayment
+
+	case len(m.Photo) > 0:
+		return KindPhoto
+	case m.Animation.FileID != "":
+		return KindAnimation
+	case m.Video.FileID != "":
+		return KindVideo
+	case m.VideoNote.FileID != "":
+		return KindVideoNote
+	case m.Voice.FileID != "":
+		return KindVoice
+	case m.Audio.FileID != "":
+		return KindAudio
+	case m.Sticker.FileID != "":
+		return KindSticker
+	case m.Document.FileID != "":
+		return KindDocument
+	case m.Game.Title != "":
+		return KindGame
+	case m.Invoice.Title != "":
+		return KindInvoice
+	case m.Poll.ID != "":
+		return KindPoll
+	case m.Dice.Emoji != "":
+		return KindDice
+	case m.Venue.Title != "":
+		return KindVenue
+	case m.Location != Location{}:
+		return KindLocation
+	case m.Contact.PhoneNumber != "":
+		return KindContact
+	case m.isCommand():
+		return KindCommand
+	case m.Text != "":
+		return KindText
+	}
+	return KindUnknown
+}
+
+// isCommand говорит, что текст начинается с команды боту.
+func (m *Message) isCommand() bool {
+	for _, entity := range m.Entities {
+		if entity.Type == "bot_command" && entity.Offset == 0 {
+			return true
+		}
+	}
+	return len(m.Entities) == 0 && strings.HasPrefix(m.Text, "/")
+}
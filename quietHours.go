@@ -0,0 +1,182 @@
+package telebot
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// QuietHours - время, когда получателя нельзя беспокоить, например
+// с "22:00" до "08:00" по его часовому поясу.
+type QuietHours struct {
+	// Начало и конец в формате "15:04". Если From позже To, тихие часы
+	// переходят через полночь. При равных значениях тихих часов нет.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Часовой пояс, например "Europe/Moscow", пустой - UTC
+	Timezone string `json:"timezone,omitempty"`
+	// Hold задерживает сообщения до конца тихих часов, иначе они
+	// отправляются без звука.
+	Hold bool `json:"hold,omitempty"`
+}
+
+// IsZero говорит, что тихие часы не заданы.
+func (q QuietHours) IsZero() bool {
+	return q.From == q.To
+}
+
+// Until возвращает конец тихих часов, если t попадает в них.
+func (q QuietHours) Until(t time.Time) (end time.Time, quiet bool, err error) {
+	if q.IsZero() {
+		return time.Time{}, false, nil
+	}
+	loc, err := loadLocation(q.Timezone)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	from, err := parseClock(q.From)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	to, err := parseClock(q.To)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	local := t.In(loc)
+	now := local.Hour()*60 + local.Minute()
+	if from < to {
+		quiet = now >= from && now < to
+	} else {
+		quiet = now >= from || now < to
+	}
+	if !quiet {
+		return time.Time{}, false, nil
+	}
+
+	end = time.Date(local.Year(), local.Month(), local.Day(), to/60, to%60, 0, 0, loc)
+	if !end.After(local) {
+		end = time.Date(local.Year(), local.Month(), local.Day()+1, to/60, to%60, 0, 0, loc)
+	}
+	return end, true, nil
+}
+
+// parseClock возвращает количество минут от полуночи.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("telebot: bad quiet hours time '%s'", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// PreferenceStore хранит настройки доставки получателей по Recipient.Destination().
+type PreferenceStore interface {
+	// QuietHours возвращает нулевые QuietHours, если они не заданы.
+	QuietHours(destination string) (QuietHours, error)
+	SetQuietHours(destination string, q QuietHours) error
+}
+
+// MemoryPreferenceStore - PreferenceStore в памяти процесса.
+type MemoryPreferenceStore struct {
+	mu    sync.RWMutex
+	quiet map[string]QuietHours
+}
+
+func NewMemoryPreferenceStore() *MemoryPreferenceStore {
+	return &MemoryPreferenceStore{quiet: make(map[string]QuietHours)}
+}
+
+func (s *MemoryPreferenceStore) QuietHours(destination string) (QuietHours, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.quiet[destination], nil
+}
+
+func (s *MemoryPreferenceStore) SetQuietHours(destination string, q QuietHours) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q.IsZero() {
+		delete(s.quiet, destination)
+	} else {
+		s.quiet[destination] = q
+	}
+	return nil
+}
+
+// SetPreferences подключает настройки получателей. В тихие часы получателя
+// сообщения с приоритетом ниже PriorityUrgent задерживаются или
+// отправляются без звука.
+func (s *DeferredSender) SetPreferences(prefs PreferenceStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prefs = prefs
+}
+
+// quiet проверяет тихие часы получателя перед отправкой. Возвращает true,
+// если сообщение возвращено в очередь до конца тихих часов или, после
+// Stop, отложено до перезапуска. Иначе в тихие часы включает для сообщения
+// DisableNotification.
+func (s *DeferredSender) quiet(dm *DeferredMessage, now time.Time) bool {
+	s.mu.Lock()
+	prefs := s.prefs
+	s.mu.Unlock()
+
+	if prefs == nil || dm.Priority >= PriorityUrgent {
+		return false
+	}
+	q, err := prefs.QuietHours(dm.Recipient.Destination())
+	var end time.Time
+	var quiet bool
+	if err == nil {
+		end, quiet, err = q.Until(now)
+	}
+	if err != nil {
+		log.Println("telebot: quiet hours are ignored:", err)
+		return false
+	}
+	if !quiet {
+		return false
+	}
+
+	if q.Hold {
+		dm.notBefore = end
+		s.mu.Lock()
+		held := s.requeue(*dm, now)
+		s.mu.Unlock()
+		if !held {
+			dm.Request.Done(ErrSenderStopped)
+		}
+		return true
+	}
+	if r, ok := dm.Request.(silencer); ok {
+		r.silence()
+	}
+	return false
+}
+
+// silencer - запрос, который можно отправить без звука.
+type silencer interface {
+	silence()
+}
+
+// silenced возвращает копию настроек с DisableNotification.
+func silenced(o *SendOptions) *SendOptions {
+	silent := SendOptions{}
+	if o != nil {
+		silent = *o
+	}
+	silent.DisableNotification = true
+	return &silent
+}
+
+func (r *TextRequest) silence()     { r.Options = silenced(r.Options) }
+func (r *PhotoRequest) silence()    { r.Options = silenced(r.Options) }
+func (r *AudioRequest) silence()    { r.Options = silenced(r.Options) }
+func (r *DocumentRequest) silence() { r.Options = silenced(r.Options) }
+func (r *StickerRequest) silence()  { r.Options = silenced(r.Options) }
+func (r *VideoRequest) silence()    { r.Options = silenced(r.Options) }
+func (r *LocationRequest) silence() { r.Options = silenced(r.Options) }
+func (r *VenueRequest) silence()    { r.Options = silenced(r.Options) }
+func (r *batchRequest) silence()    { r.text.silence() }
@@ -0,0 +1,89 @@
+package telebot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuietHours(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	q := QuietHours{From: "22:00", To: "08:00", Timezone: "Europe/Moscow"}
+
+	end, quiet, err := q.Until(time.Date(2024, 5, 17, 23, 30, 0, 0, moscow))
+	if err != nil || !quiet || !end.Equal(time.Date(2024, 5, 18, 8, 0, 0, 0, moscow)) {
+		t.Fatal("Quiet hours must cross midnight:", end, quiet, err)
+	}
+	end, quiet, _ = q.Until(time.Date(2024, 5, 18, 7, 59, 0, 0, moscow))
+	if !quiet || !end.Equal(time.Date(2024, 5, 18, 8, 0, 0, 0, moscow)) {
+		t.Fatal("Quiet hours must end the same morning:", end)
+	}
+	if _, quiet, _ = q.Until(time.Date(2024, 5, 18, 8, 0, 0, 0, moscow)); quiet {
+		t.Fatal("Quiet hours must end at To.")
+	}
+	if _, _, err := (QuietHours{From: "25:00", To: "08:00"}).Until(time.Now()); err == nil {
+		t.Fatal("Bad time must be rejected.")
+	}
+}
+
+func TestDeferredSenderQuietHours(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	prefs := NewMemoryPreferenceStore()
+	s.SetPreferences(prefs)
+
+	now := time.Date(2024, 5, 17, 23, 0, 0, 0, time.UTC)
+	prefs.SetQuietHours("1", QuietHours{From: "22:00", To: "08:00"})
+	prefs.SetQuietHours("2", QuietHours{From: "22:00", To: "08:00", Hold: true})
+
+	silent := DeferredMessage{Recipient: User{ID: 1}, Request: &TextRequest{To: User{ID: 1}}}
+	if s.quiet(&silent, now) || !silent.Request.(*TextRequest).Options.DisableNotification {
+		t.Fatal("Message must be sent silently during quiet hours.")
+	}
+
+	held := DeferredMessage{Recipient: User{ID: 2}, Request: &TextRequest{To: User{ID: 2}}}
+	if !s.quiet(&held, now) || s.Len() != 1 {
+		t.Fatal("Message must be held until quiet hours end.")
+	}
+	if stats := s.ChatStats(User{ID: 2}); stats.Depth != 1 {
+		t.Fatal("Held message must stay in the queue.")
+	}
+	if !held.notBefore.Equal(time.Date(2024, 5, 18, 8, 0, 0, 0, time.UTC)) {
+		t.Fatal("Held message must wait for the end of quiet hours:", held.notBefore)
+	}
+
+	urgent := DeferredMessage{Recipient: User{ID: 2}, Priority: PriorityUrgent, Request: &TextRequest{To: User{ID: 2}}}
+	if s.quiet(&urgent, now) || urgent.Request.(*TextRequest).Options != nil {
+		t.Fatal("Urgent messages must bypass quiet hours.")
+	}
+}
+
+func TestDeferredSenderQuietHoursBatch(t *testing.T) {
+	s := NewDeferredSender(&Bot{}, 0)
+	s.limiter = NewRateLimiter(RateLimits{})
+	s.SetBatching(Batching{Join: DefaultBatchJoin})
+	prefs := NewMemoryPreferenceStore()
+	s.SetPreferences(prefs)
+	prefs.SetQuietHours("1", QuietHours{From: "22:00", To: "08:00", Hold: true})
+
+	for _, text := range []string{"cpu", "disk"} {
+		s.Enqueue(&DeferredMessage{BatchKey: "alerts", Request: &TextRequest{To: User{ID: 1}, Text: text}})
+	}
+	dm, _ := s.next()
+	if _, ok := dm.Request.(*batchRequest); !ok {
+		t.Fatal("Messages must be merged:", dm.Request)
+	}
+
+	// Объединенное сообщение возвращается в очередь по частям
+	if !s.quiet(&dm, time.Date(2024, 5, 17, 23, 0, 0, 0, time.UTC)) || s.Len() != 2 || s.Stats().Depth != 2 {
+		t.Fatal("Held batch must be counted per message:", s.Len())
+	}
+	prefs.SetQuietHours("1", QuietHours{From: "22:00", To: "08:00"})
+	dm, _ = s.next()
+	batch := dm.Request.(*batchRequest)
+	if batch.text.Text != "cpu\n\ndisk" {
+		t.Fatal("Held messages must be merged again:", batch.text.Text)
+	}
+	if s.quiet(&dm, time.Date(2024, 5, 17, 23, 0, 0, 0, time.UTC)) || !batch.text.Options.DisableNotification {
+		t.Fatal("Batch must be sent silently during quiet hours.")
+	}
+}
@@ -0,0 +1,185 @@
+package telebot
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimits - ограничения Telegram на исходящие сообщения.
+type RateLimits struct {
+	// Общий лимит бота по всем чатам.
+	Global Limit
+	// Лимит на один личный чат.
+	Private Limit
+	// Лимит на одну группу, супергруппу или канал.
+	Group Limit
+}
+
+// DefaultRateLimits соответствуют документации Telegram: около 30 сообщений
+// в секунду всего, 1 сообщение в секунду в личный чат и 20 в минуту в группу.
+var DefaultRateLimits = RateLimits{
+	Global:  Limit{Count: 30, Per: time.Second},
+	Private: Limit{Count: 1, Per: time.Second},
+	Group:   Limit{Count: 20, Per: time.Minute},
+}
+
+// RateLimiter ограничивает частоту исходящих сообщений корзинами токенов:
+// общей и отдельной для каждого чата, лимит которой зависит от типа чата.
+// Методы безопасны для вызова из разных горутин.
+type RateLimiter struct {
+	limits RateLimits
+
+	mu        sync.Mutex
+	global    *tokenBucket
+	chats     map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// NewRateLimiter создает ограничитель. Нулевой Limit отключает проверку.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	l := &RateLimiter{
+		limits: limits,
+		chats:  make(map[string]*tokenBucket),
+	}
+	if !limits.Global.IsZero() {
+		l.global = newTokenBucket(limits.Global, time.Now())
+	}
+	return l
+}
+
+// Delay возвращает время, через которое можно будет отправить сообщение
+// получателю. Токены не расходуются.
+func (l *RateLimiter) Delay(r Recipient) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.delay(r, time.Now())
+}
+
+// Allow расходует токены и возвращает true, если сообщение можно
+// отправить прямо сейчас.
+func (l *RateLimiter) Allow(r Recipient) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.allow(r, time.Now())
+}
+
+// Wait блокируется, пока сообщение получателю нельзя отправить,
+// и расходует токены.
+func (l *RateLimiter) Wait(r Recipient) {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		d := l.delay(r, now)
+		if d == 0 {
+			l.allow(r, now)
+			l.mu.Unlock()
+			return
+		}
+		l.mu.Unlock()
+
+		time.Sleep(d)
+	}
+}
+
+// delays возвращает по отдельности задержки общего лимита и лимита чата.
+func (l *RateLimiter) delays(r Recipient) (global, chat time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.global != nil {
+		global = l.global.delay(now)
+	}
+	if tb := l.chatBucket(r, now); tb != nil {
+		chat = tb.delay(now)
+	}
+	return global, chat
+}
+
+func (l *RateLimiter) delay(r Recipient, now time.Time) time.Duration {
+	var d time.Duration
+	if l.global != nil {
+		d = l.global.delay(now)
+	}
+	if tb := l.chatBucket(r, now); tb != nil {
+		if chatDelay := tb.delay(now); chatDelay > d {
+			d = chatDelay
+		}
+	}
+	return d
+}
+
+func (l *RateLimiter) allow(r Recipient, now time.Time) bool {
+	if l.delay(r, now) > 0 {
+		return false
+	}
+	if l.global != nil {
+		l.global.take(now)
+	}
+	if tb := l.chatBucket(r, now); tb != nil {
+		tb.take(now)
+	}
+	return true
+}
+
+func (l *RateLimiter) chatBucket(r Recipient, now time.Time) *tokenBucket {
+	l.sweep(now)
+
+	limit := l.limits.Private
+	if chatType(r) != "private" {
+		limit = l.limits.Group
+	}
+	if limit.IsZero() {
+		return nil
+	}
+	return bucketFor(l.chats, r.Destination(), limit, now)
+}
+
+// sweep раз в минуту удаляет корзины чатов, которым давно ничего не отправляли.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for k, tb := range l.chats {
+		if tb.full(now) {
+			delete(l.chats, k)
+		}
+	}
+}
+
+// chatType определяет тип чата получателя: "private", "group",
+// "supergroup" или "channel". Для произвольного Recipient тип угадывается
+// по Destination: "@имя" - канал, отрицательный id - группа.
+func chatType(r Recipient) string {
+	switch c := r.(type) {
+	case User, *User:
+		return "private"
+	case Chat:
+		if c.Type != "" {
+			return c.Type
+		}
+	case *Chat:
+		if c.Type != "" {
+			return c.Type
+		}
+	}
+
+	destination := r.Destination()
+	switch {
+	case strings.HasPrefix(destination, "@"):
+		return "channel"
+	case strings.HasPrefix(destination, "-"):
+		return "group"
+	}
+	return "private"
+}
+
+// limit ждет, пока ограничитель бота разрешит отправку получателю.
+func (b *Bot) limit(r Recipient) {
+	if b.Limiter != nil {
+		b.Limiter.Wait(r)
+	}
+}
@@ -0,0 +1,41 @@
+package telebot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(RateLimits{
+		Global:  Limit{Count: 3, Per: time.Second},
+		Private: Limit{Count: 1, Per: time.Second},
+		Group:   Limit{Count: 2, Per: time.Minute},
+	})
+	now := time.Now()
+
+	if !l.allow(User{ID: 1}, now) || l.allow(User{ID: 1}, now) {
+		t.Fatal("Private chat must get one message per second.")
+	}
+	group := Chat{ID: -100, Type: "supergroup"}
+	if !l.allow(group, now) || !l.allow(group, now) {
+		t.Fatal("Group must accept a burst.")
+	}
+	if l.allow(User{ID: 2}, now) {
+		t.Fatal("Global limit must be enforced.")
+	}
+	if d := l.delay(group, now.Add(time.Second)); d < 20*time.Second {
+		t.Fatal("Group limit must be per minute, got", d)
+	}
+	if !l.allow(User{ID: 1}, now.Add(time.Second)) {
+		t.Fatal("Private bucket must refill.")
+	}
+}
+
+func TestChatType(t *testing.T) {
+	if chatType(User{ID: 1}) != "private" || chatType(Chat{ID: -1, Type: "group"}) != "group" {
+		t.Fatal("Can't tell chat type from a typed recipient.")
+	}
+	if chatType(Chat{Type: "channel", Username: "news"}) != "channel" {
+		t.Fatal("Can't tell channel apart.")
+	}
+}
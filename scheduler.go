@@ -0,0 +1,564 @@
+package telebot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrJobNotFound возвращается при отмене несуществующего задания
+var ErrJobNotFound = errors.New("telebot: scheduled job not found")
+
+// Через сколько повторить постановку в очередь, если очередь переполнена
+const scheduleRetryInterval = time.Second
+
+// ScheduledJob - задание планировщика в том виде, в котором оно хранится.
+type ScheduledJob struct {
+	ID string `json:"id"`
+	// Время следующей отправки
+	At time.Time `json:"at"`
+	// Расписание в формате cron для повторяющихся заданий
+	Cron string `json:"cron,omitempty"`
+	// Часовой пояс расписания, например "Europe/Moscow"
+	Location string        `json:"location,omitempty"`
+	Message  StoredMessage `json:"message"`
+}
+
+// ScheduleStore хранит задания планировщика, чтобы они пережили перезапуск.
+type ScheduleStore interface {
+	Save(job ScheduledJob) error
+	Delete(id string) error
+	Load() ([]ScheduledJob, error)
+}
+
+// scheduledJob - задание в памяти вместе с исходным сообщением.
+type scheduledJob struct {
+	ScheduledJob
+	cron     *cronSchedule
+	location *time.Location
+	// Исходное сообщение с Callback, nil для восстановленных заданий
+	message *DeferredMessage
+}
+
+// Scheduler ставит сообщения в очередь DeferredSender в заданное время.
+//
+// После постановки в очередь задание удаляется из хранилища (или для
+// повторяющихся заданий сохраняется время следующей отправки). Если
+// поставить сообщение в очередь не удалось, задание остается и
+// повторяется через scheduleRetryInterval. Если бот остановится между
+// постановкой в очередь и записью в хранилище, сообщение может быть
+// отправлено повторно. Задания, время которых прошло, пока бот не
+// работал, отправляются один раз.
+type Scheduler struct {
+	sender *DeferredSender
+	store  ScheduleStore
+
+	mu   sync.Mutex
+	jobs map[string]*scheduledJob
+	wake chan struct{}
+	quit chan struct{}
+}
+
+// NewScheduler создает планировщик и загружает задания из store.
+// store может быть nil, тогда задания хранятся только в памяти.
+func NewScheduler(sender *DeferredSender, store ScheduleStore) (*Scheduler, error) {
+	s := &Scheduler{
+		sender: sender,
+		store:  store,
+		jobs:   make(map[string]*scheduledJob),
+		wake:   make(chan struct{}, 1),
+		quit:   make(chan struct{}),
+	}
+	if store == nil {
+		return s, nil
+	}
+
+	jobs, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, stored := range jobs {
+		job := &scheduledJob{ScheduledJob: stored}
+		if stored.Cron != "" {
+			if job.location, err = loadLocation(stored.Location); err != nil {
+				return nil, err
+			}
+			if job.cron, err = parseCron(stored.Cron); err != nil {
+				return nil, err
+			}
+		}
+		s.jobs[stored.ID] = job
+	}
+	return s, nil
+}
+
+// SendAt ставит сообщение в очередь в момент at. Возвращает ID задания.
+func (s *Scheduler) SendAt(at time.Time, dm *DeferredMessage) (string, error) {
+	return s.add(&scheduledJob{ScheduledJob: ScheduledJob{At: at}, message: dm})
+}
+
+// Every ставит сообщение в очередь по расписанию cron в часовом поясе loc
+// (nil - UTC). Поддерживаются поля "минута час день месяц день_недели"
+// со значениями *, a-b, */n, a-b/n, списками через запятую, а также
+// @hourly, @daily, @weekly, @monthly.
+func (s *Scheduler) Every(spec string, loc *time.Location, dm *DeferredMessage) (string, error) {
+	cron, err := parseCron(spec)
+	if err != nil {
+		return "", err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	job := &scheduledJob{
+		ScheduledJob: ScheduledJob{Cron: spec, Location: loc.String()},
+		cron:         cron,
+		location:     loc,
+		message:      dm,
+	}
+	job.At = cron.next(time.Now().In(loc))
+	if job.At.IsZero() {
+		return "", fmt.Errorf("telebot: cron spec '%s' never matches", spec)
+	}
+	return s.add(job)
+}
+
+func (s *Scheduler) add(job *scheduledJob) (string, error) {
+	request, err := job.message.request()
+	if err != nil {
+		return "", err
+	}
+	job.message.Request = request
+	if job.message.Recipient == nil {
+		job.message.Recipient = request.Chat()
+	}
+
+	stored, err := newStoredMessage(job.message)
+	if err != nil {
+		return "", err
+	}
+	if stored == nil {
+		if s.store != nil {
+			return "", fmt.Errorf("telebot: request %T can't be stored", request)
+		}
+		stored = &StoredMessage{
+			Recipient: job.message.Recipient.Destination(),
+			ChatType:  chatType(job.message.Recipient),
+			Priority:  job.message.Priority,
+		}
+	}
+	job.Message = *stored
+	job.ID = newJobID()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.store != nil {
+		if err := s.store.Save(job.ScheduledJob); err != nil {
+			return "", err
+		}
+	}
+	s.jobs[job.ID] = job
+	s.notify()
+	return job.ID, nil
+}
+
+// Cancel отменяет задание.
+func (s *Scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	if s.store != nil {
+		if err := s.store.Delete(id); err != nil {
+			return err
+		}
+	}
+	delete(s.jobs, id)
+	s.notify()
+	return nil
+}
+
+// Pending возвращает задания, отсортированные по времени отправки.
+func (s *Scheduler) Pending() []ScheduledJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]ScheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job.ScheduledJob)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].At.Before(jobs[j].At)
+	})
+	return jobs
+}
+
+// Run ставит в очередь наступившие задания. Блокируется до вызова Stop.
+func (s *Scheduler) Run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		wait := s.fire(time.Now())
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-s.quit:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// Stop завершает Run. Задания остаются в хранилище.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+}
+
+// fire ставит в очередь наступившие задания и возвращает время до следующего.
+func (s *Scheduler) fire(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Hour
+	for id, job := range s.jobs {
+		if job.At.After(now) {
+			if d := job.At.Sub(now); d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		dm, err := job.deferredMessage()
+		if err != nil {
+			log.Println("telebot: dropping scheduled job", id, err)
+			s.remove(id)
+			continue
+		}
+
+		if err := s.sender.Enqueue(&dm); err != nil {
+			// Задание в хранилище не меняется, в памяти откладываем попытку
+			log.Println("telebot: failed to enqueue scheduled job", id, err)
+			job.At = now.Add(scheduleRetryInterval)
+		} else if job.cron != nil {
+			job.At = job.cron.next(now.In(job.location))
+			if job.At.IsZero() {
+				s.remove(id)
+			} else {
+				s.save(job)
+			}
+		} else {
+			s.remove(id)
+		}
+
+		if d := job.At.Sub(now); job.At.After(now) && d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func (s *Scheduler) save(job *scheduledJob) {
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Save(job.ScheduledJob); err != nil {
+		log.Println("telebot: failed to save scheduled job", job.ID, err)
+	}
+}
+
+func (s *Scheduler) remove(id string) {
+	delete(s.jobs, id)
+	if s.store == nil {
+		return
+	}
+	if err := s.store.Delete(id); err != nil {
+		log.Println("telebot: failed to delete scheduled job", id, err)
+	}
+}
+
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deferredMessage возвращает сообщение для очередной отправки. Задания,
+// восстановленные из хранилища, отправляются без Callback. Повторяющиеся
+// задания получают новый запрос при каждой отправке, чтобы отправки не
+// делили результат запроса; Callback переносится из исходного запроса.
+// Запросы, которые нельзя сохранить, используются повторно.
+func (job *scheduledJob) deferredMessage() (DeferredMessage, error) {
+	if job.message == nil {
+		return job.Message.deferredMessage()
+	}
+	dm := *job.message
+	if job.cron == nil || job.Message.Kind == "" {
+		return dm, nil
+	}
+
+	fresh, err := job.Message.deferredMessage()
+	if err != nil {
+		return DeferredMessage{}, err
+	}
+	request := fresh.Request.(StorableRequest)
+	request.SetChat(dm.Recipient)
+	copyCallback(request, dm.Request)
+	dm.Request = request
+	return dm, nil
+}
+
+// copyCallback копирует поле Callback между запросами одного типа.
+func copyCallback(to, from Request) {
+	dst, src := reflect.ValueOf(to), reflect.ValueOf(from)
+	if dst.Type() != src.Type() || src.Kind() != reflect.Ptr || src.Elem().Kind() != reflect.Struct {
+		return
+	}
+	callback := dst.Elem().FieldByName("Callback")
+	if callback.IsValid() && callback.CanSet() {
+		callback.Set(src.Elem().FieldByName("Callback"))
+	}
+}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// FileScheduleStore хранит задания в JSON файле, перезаписывая его целиком
+// при каждом изменении.
+type FileScheduleStore struct {
+	path string
+
+	mu   sync.Mutex
+	jobs map[string]ScheduledJob
+}
+
+// OpenFileScheduleStore открывает файл заданий, создавая его при необходимости.
+func OpenFileScheduleStore(path string) (*FileScheduleStore, error) {
+	s := &FileScheduleStore{path: path, jobs: make(map[string]ScheduledJob)}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		var jobs []ScheduledJob
+		if err := json.Unmarshal(data, &jobs); err != nil {
+			return nil, err
+		}
+		for _, job := range jobs {
+			s.jobs[job.ID] = job
+		}
+	}
+	return s, nil
+}
+
+func (s *FileScheduleStore) Save(job ScheduledJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return s.flush()
+}
+
+func (s *FileScheduleStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, id)
+	return s.flush()
+}
+
+func (s *FileScheduleStore) Load() ([]ScheduledJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]ScheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+func (s *FileScheduleStore) flush() error {
+	jobs := make([]ScheduledJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	data, err := json.Marshal(jobs)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// cronSchedule - разобранное расписание cron. Поля хранятся битовыми масками.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Если ограничены и день месяца, и день недели, достаточно совпадения любого
+	domAny, dowAny bool
+}
+
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func parseCron(spec string) (*cronSchedule, error) {
+	if alias, ok := cronAliases[strings.TrimSpace(spec)]; ok {
+		spec = alias
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("telebot: cron spec '%s' must have 5 fields", spec)
+	}
+
+	c := &cronSchedule{
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	// 7 - тоже воскресенье
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("telebot: bad cron step in '%s'", field)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		from, to := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			n, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("telebot: bad cron value in '%s'", field)
+			}
+			from, to = n, n
+			if len(bounds) == 2 {
+				if to, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("telebot: bad cron value in '%s'", field)
+				}
+			} else if step > 1 {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return 0, fmt.Errorf("telebot: cron value out of range in '%s'", field)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next возвращает ближайший момент после t, подходящий под расписание.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,146 @@
+package telebot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	c, err := parseCron("30 9 * * 1-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Friday evening -> Monday 09:30
+	next := c.next(time.Date(2024, 5, 17, 20, 0, 0, 0, moscow))
+	if !next.Equal(time.Date(2024, 5, 20, 9, 30, 0, 0, moscow)) {
+		t.Fatal("Wrong next run:", next)
+	}
+
+	c, _ = parseCron("*/15 * 1 * 0")
+	next = c.next(time.Date(2024, 5, 17, 20, 50, 0, 0, time.UTC))
+	if !next.Equal(time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("Day of month and weekday must match either:", next)
+	}
+
+	for _, spec := range []string{"* * *", "60 * * * *", "* * * * */0"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Fatal("Bad spec must be rejected:", spec)
+		}
+	}
+}
+
+func TestScheduler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenFileScheduleStore(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := NewDeferredSender(&Bot{}, 0)
+	s, _ := NewScheduler(sender, store)
+
+	now := time.Now()
+	due, _ := s.SendAt(now.Add(-time.Second), &DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "due"}})
+	later, _ := s.SendAt(now.Add(time.Hour), &DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "later"}})
+	daily, err := s.Every("@daily", nil, &DeferredMessage{Request: &TextRequest{To: User{ID: 2}, Text: "digest"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SendAt(now, &DeferredMessage{Request: &ChatActionRequest{To: User{ID: 1}}}); err == nil {
+		t.Fatal("Requests that can't be stored must be rejected with a store.")
+	}
+
+	s.fire(now)
+	if sender.Len() != 1 {
+		t.Fatal("Due job must be enqueued.")
+	}
+	if err := s.Cancel(due); err != ErrJobNotFound {
+		t.Fatal("Fired one-shot job must be removed.")
+	}
+	if err := s.Cancel(later); err != nil {
+		t.Fatal(err)
+	}
+
+	// Restart.
+	store, _ = OpenFileScheduleStore(filepath.Join(dir, "jobs.json"))
+	s, err = NewScheduler(sender, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := s.Pending()
+	if len(pending) != 1 || pending[0].ID != daily || pending[0].Cron != "@daily" {
+		t.Fatal("Only the recurring job must survive restart:", pending)
+	}
+
+	s.fire(pending[0].At)
+	if sender.Len() != 2 || !s.Pending()[0].At.After(pending[0].At) {
+		t.Fatal("Recurring job must be enqueued and moved to the next run.")
+	}
+}
+
+func TestSchedulerEnqueueFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := OpenFileScheduleStore(filepath.Join(dir, "jobs.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := NewDeferredSender(&Bot{}, 0)
+	s, _ := NewScheduler(sender, store)
+
+	now := time.Now()
+	id, _ := s.SendAt(now.Add(-time.Second), &DeferredMessage{Request: &TextRequest{To: User{ID: 1}, Text: "due"}})
+	sender.Stop(context.Background())
+
+	// Задание, которое не удалось поставить в очередь, не теряется
+	s.fire(now)
+	if pending := s.Pending(); len(pending) != 1 || pending[0].ID != id || !pending[0].At.After(now) {
+		t.Fatal("Job must be kept and retried later:", pending)
+	}
+	store, _ = OpenFileScheduleStore(filepath.Join(dir, "jobs.json"))
+	if jobs, _ := store.Load(); len(jobs) != 1 || jobs[0].ID != id {
+		t.Fatal("Job must stay in the store:", jobs)
+	}
+}
+
+func TestSchedulerRecurringRequests(t *testing.T) {
+	sender := NewDeferredSender(&Bot{}, 0)
+	s, _ := NewScheduler(sender, nil)
+
+	var results []*MsgResult
+	original := &TextRequest{To: User{ID: 1}, Text: "digest", Callback: func(r *MsgResult, err error) {
+		results = append(results, r)
+	}}
+	if _, err := s.Every("@hourly", nil, &DeferredMessage{Request: original}); err != nil {
+		t.Fatal(err)
+	}
+
+	sender.limiter = NewRateLimiter(RateLimits{})
+	var requests []*TextRequest
+	for i := 0; i < 2; i++ {
+		s.fire(s.Pending()[0].At)
+		dm, _ := sender.next()
+		requests = append(requests, dm.Request.(*TextRequest))
+	}
+	if requests[0] == requests[1] || requests[0] == original || requests[1].Text != "digest" {
+		t.Fatal("Each firing must get a fresh request.")
+	}
+	requests[1].Done(nil)
+	if len(results) != 1 {
+		t.Fatal("Callback must be kept for every firing.")
+	}
+}
@@ -0,0 +1,368 @@
+package telebot
+
+import (
+	"errors"
+	"unicode"
+	"unicode/utf16"
+)
+
+// MaxCaptionLength - наибольшая длина подписи к медиа в единицах UTF-16.
+const MaxCaptionLength = 1024
+
+var ErrCannotSplit = errors.New("telebot: text can't be split without breaking markup")
+
+// MessageChunk - часть длинного сообщения, готовая к отправке.
+type MessageChunk struct {
+	Text    string
+	Options *SendOptions
+}
+
+// SplitMessage делит text на части не длиннее limit единиц UTF-16 видимого
+// текста. Текст делится по абзацам, строкам или словам и только в крайнем
+// случае посреди слова, но никогда посреди суррогатной пары.
+//
+// В ModeHTML и ModeDefault сущность на границе частей разбивается на две,
+// каждая часть остается корректной. В ModeMarkdown и ModeMarkdownV2 текст
+// делится только вне разметки; если это невозможно, возвращается
+// ErrCannotSplit.
+//
+// ReplyTo остается только у первой части, ReplyMarkup - только у последней.
+func SplitMessage(text string, options *SendOptions, limit int) ([]MessageChunk, error) {
+	s, err := newTextSplitter(text, options)
+	if err != nil {
+		return nil, err
+	}
+	var chunks []MessageChunk
+	for {
+		chunk, ok, err := s.next(limit)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		chunks = append(chunks, chunk)
+	}
+	s.finish(chunks)
+	return chunks, nil
+}
+
+// SendLongMessage отправляет текст, который может быть длиннее
+// MaxMessageLength, несколькими сообщениями по порядку. Возвращает
+// результаты всех отправленных сообщений; при ошибке - тех, что успели
+// отправиться.
+func (b *Bot) SendLongMessage(recipient Recipient, text string, options *SendOptions) ([]*MsgResult, error) {
+	chunks, err := SplitMessage(text, options, MaxMessageLength)
+	if err != nil {
+		return nil, err
+	}
+	var results []*MsgResult
+	for _, chunk := range chunks {
+		result, err := b.SendMessage(recipient, chunk.Text, chunk.Options)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// SendLongPhoto отправляет фото с подписью, которая может быть длиннее
+// MaxCaptionLength. Подпись к фото обрезается по границе, а остаток
+// отправляется следующими текстовыми сообщениями.
+func (b *Bot) SendLongPhoto(recipient Recipient, photo *Photo, options *SendOptions) ([]*MsgResult, error) {
+	s, err := newTextSplitter(photo.Caption, options)
+	if err != nil {
+		return nil, err
+	}
+	first, _, err := s.next(MaxCaptionLength)
+	if err != nil {
+		return nil, err
+	}
+	chunks := []MessageChunk{first}
+	for {
+		chunk, ok, err := s.next(MaxMessageLength)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		chunks = append(chunks, chunk)
+	}
+	s.finish(chunks)
+
+	caption := photo.Caption
+	photo.Caption = first.Text
+	result, err := b.sendPhoto(recipient, photo, chunks[0].Options)
+	photo.Caption = caption
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*MsgResult{result}
+	for _, chunk := range chunks[1:] {
+		result, err := b.SendMessage(recipient, chunk.Text, chunk.Options)
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// textSplitter выделяет из текста части по очереди. В режимах с
+// сущностями он работает с видимым текстом, в Markdown - с разметкой.
+type textSplitter struct {
+	options  SendOptions
+	runes    []rune
+	entities []MessageEntity
+	// Для Markdown: можно ли разрезать текст перед руной i
+	safe []bool
+
+	pos   int
+	units int
+	done  bool
+}
+
+func newTextSplitter(text string, options *SendOptions) (*textSplitter, error) {
+	s := &textSplitter{}
+	if options != nil {
+		s.options = *options
+	}
+
+	switch s.options.ParseMode {
+	case ModeHTML:
+		plain, entities, err := ParseHTML(text)
+		if err != nil {
+			return nil, err
+		}
+		s.runes, s.entities = []rune(plain), entities
+	case ModeMarkdown, ModeMarkdownV2:
+		s.runes = []rune(text)
+		s.safe = markdownSplitPoints(s.runes, s.options.ParseMode == ModeMarkdownV2)
+	default:
+		s.runes, s.entities = []rune(text), s.options.Entities
+	}
+	return s, nil
+}
+
+// next возвращает следующую часть не длиннее limit единиц UTF-16.
+func (s *textSplitter) next(limit int) (MessageChunk, bool, error) {
+	if s.done {
+		return MessageChunk{}, false, nil
+	}
+	// Пробелы между частями не нужны ни одной из них
+	for s.pos > 0 && s.pos < len(s.runes) && unicode.IsSpace(s.runes[s.pos]) && s.allowed(s.pos+1) {
+		s.advance(s.pos + 1)
+	}
+	if s.pos > 0 && s.pos == len(s.runes) {
+		s.done = true
+		return MessageChunk{}, false, nil
+	}
+
+	// Самая дальняя граница, до которой часть помещается в limit
+	end, units := s.pos, 0
+	for end < len(s.runes) {
+		width := len(utf16.Encode(s.runes[end : end+1]))
+		if units+width > limit {
+			break
+		}
+		units += width
+		end++
+	}
+
+	cut := end
+	if end < len(s.runes) {
+		if cut = s.boundary(end); cut < 0 {
+			return MessageChunk{}, false, ErrCannotSplit
+		}
+	}
+
+	stop := cut
+	for stop > s.pos && unicode.IsSpace(s.runes[stop-1]) && (s.safe == nil || stop < 2 || s.runes[stop-2] != '\\') {
+		stop--
+	}
+	text := string(s.runes[s.pos:stop])
+	start, finish := s.units, s.units+utf16Len(text)
+	s.advance(cut)
+	s.done = s.pos == len(s.runes)
+
+	chunk := MessageChunk{Text: text}
+	if s.safe != nil {
+		return chunk, true, nil
+	}
+
+	var entities []MessageEntity
+	for _, e := range s.entities {
+		from, to := e.Offset, e.Offset+e.Length
+		if from < start {
+			from = start
+		}
+		if to > finish {
+			to = finish
+		}
+		if to > from {
+			e.Offset, e.Length = from-start, to-from
+			entities = append(entities, e)
+		}
+	}
+	if s.options.ParseMode == ModeHTML {
+		chunk.Text = RenderEntities(text, entities, ModeHTML)
+	} else {
+		chunk.Options = &SendOptions{Entities: entities}
+	}
+	return chunk, true, nil
+}
+
+// boundary выбирает место разреза не дальше end: конец абзаца или строки
+// во второй половине части, иначе последний пробел, иначе любое
+// допустимое место.
+func (s *textSplitter) boundary(end int) int {
+	half := s.pos + (end-s.pos)/2
+	paragraph := func(i int) bool { return i >= 2 && s.runes[i-1] == '\n' && s.runes[i-2] == '\n' }
+	line := func(i int) bool { return s.runes[i-1] == '\n' }
+	word := func(i int) bool { return unicode.IsSpace(s.runes[i-1]) }
+	anywhere := func(int) bool { return true }
+
+	for _, rule := range []struct {
+		from  int
+		match func(int) bool
+	}{{half, paragraph}, {half, line}, {s.pos, word}, {s.pos, anywhere}} {
+		for i := end; i > rule.from; i-- {
+			if s.allowed(i) && rule.match(i) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (s *textSplitter) allowed(i int) bool {
+	return s.safe == nil || s.safe[i]
+}
+
+func (s *textSplitter) advance(to int) {
+	s.units += len(utf16.Encode(s.runes[s.pos:to]))
+	s.pos = to
+}
+
+// finish раздает частям параметры отправки: ReplyTo первой части,
+// ReplyMarkup последней, остальное - всем.
+func (s *textSplitter) finish(chunks []MessageChunk) {
+	for i := range chunks {
+		options := s.options
+		if chunks[i].Options != nil {
+			options.Entities = chunks[i].Options.Entities
+		} else {
+			options.Entities = nil
+		}
+		if i > 0 {
+			options.ReplyTo = Message{}
+		}
+		if i < len(chunks)-1 {
+			options.ReplyMarkup = ReplyMarkup{}
+		}
+		chunks[i].Options = &options
+	}
+}
+
+// markdownSplitPoints отмечает места, где текст в разметке Markdown можно
+// разрезать: вне сущностей и не после экранирующего "\".
+func markdownSplitPoints(r []rune, v2 bool) []bool {
+	safe := make([]bool, len(r)+1)
+	var open []string
+	hasPrefix := func(i int, prefix string) bool {
+		for j, c := range prefix {
+			if i+j >= len(r) || r[i+j] != c {
+				return false
+			}
+		}
+		return true
+	}
+	closing := func(token string) string {
+		switch token {
+		case "[":
+			return "]"
+		case "(":
+			return ")"
+		}
+		return token
+	}
+
+	for i := 0; i < len(r); {
+		safe[i] = len(open) == 0
+		top := ""
+		if len(open) > 0 {
+			top = open[len(open)-1]
+		}
+		verbatim := top == "```" || top == "`" || top == "("
+
+		// В устаревшем Markdown экранирование работает только вне сущностей
+		if r[i] == '\\' && (top == "" || v2) {
+			i += 2
+			continue
+		}
+
+		// Внутри кода, адреса ссылки и сущностей устаревшего Markdown
+		// значим только закрывающий разделитель
+		if verbatim || (!v2 && top != "") {
+			end := closing(top)
+			if !hasPrefix(i, end) {
+				i++
+				continue
+			}
+			open = open[:len(open)-1]
+			i += len(end)
+			if end == "]" && hasPrefix(i, "(") {
+				open = append(open, "(")
+				i++
+			}
+			continue
+		}
+
+		token := ""
+		for _, t := range []string{"```", "`", "[", "]", "||", "__", "*", "_", "~"} {
+			if hasPrefix(i, t) {
+				token = t
+				break
+			}
+		}
+		switch {
+		case token == "```" || token == "`" || token == "[":
+			open = append(open, token)
+		case token == "]":
+			if top == "[" {
+				open = open[:len(open)-1]
+				if hasPrefix(i+1, "(") {
+					open = append(open, "(")
+					i++
+				}
+			}
+		case token == "*" || token == "_" || (v2 && token != ""):
+			if !v2 && token == "__" {
+				token = "_"
+			}
+			if j := lastIndex(open, token); j >= 0 {
+				open = append(open[:j], open[j+1:]...)
+			} else {
+				open = append(open, token)
+			}
+		}
+		if token == "" {
+			i++
+		}
+		i += len(token)
+	}
+	safe[len(r)] = true
+	return safe
+}
+
+func lastIndex(list []string, s string) int {
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i] == s {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,94 @@
+package telebot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitMessage(t *testing.T) {
+	keyboard := ReplyMarkup{InlineKeyboard: [][]KeyboardButton{{{Text: "OK", Data: "ok"}}}}
+	options := &SendOptions{
+		ReplyTo:     Message{ID: 7},
+		ReplyMarkup: keyboard,
+		// "строка\nтретий" выделено жирным через границу частей
+		Entities: []MessageEntity{{Type: "bold", Offset: 22, Length: 13}},
+	}
+	text := "Первый абзац.\n\nВторая строка\nтретий абзац слово"
+
+	chunks, err := SplitMessage(text, options, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	// Конец абзаца в первой половине части, поэтому выбран конец строки
+	expected := []string{"Первый абзац.\n\nВторая строка", "третий абзац слово"}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Fatalf("Expected %q, got %q", expected, texts)
+	}
+
+	bold := [][]MessageEntity{{{Type: "bold", Offset: 22, Length: 6}}, {{Type: "bold", Offset: 0, Length: 6}}}
+	for i, chunk := range chunks {
+		if !reflect.DeepEqual(chunk.Options.Entities, bold[i]) {
+			t.Errorf("Chunk %d: expected entities %v, got %v", i, bold[i], chunk.Options.Entities)
+		}
+		if (chunk.Options.ReplyTo.ID == 7) != (i == 0) {
+			t.Errorf("Chunk %d: reply must be on the first chunk only", i)
+		}
+		if (chunk.Options.ReplyMarkup.InlineKeyboard != nil) != (i == len(chunks)-1) {
+			t.Errorf("Chunk %d: markup must be on the last chunk only", i)
+		}
+	}
+	if options.Entities[0].Offset != 22 || options.ReplyMarkup.InlineKeyboard == nil {
+		t.Fatal("Options of the caller must not change")
+	}
+
+	// Суррогатные пары не разрываются
+	chunks, _ = SplitMessage(strings.Repeat("👍", 5), nil, 3)
+	if len(chunks) != 5 || chunks[0].Text != "👍" {
+		t.Fatal("Surrogate pair is broken:", chunks)
+	}
+
+	chunks, _ = SplitMessage("короткий", nil, MaxMessageLength)
+	if len(chunks) != 1 || chunks[0].Text != "короткий" {
+		t.Fatal("Short text must stay whole:", chunks)
+	}
+}
+
+func TestSplitMessageMarkup(t *testing.T) {
+	// Длина считается по видимому тексту, разметка переоткрывается
+	chunks, err := SplitMessage(`<b>один два &amp; три</b> <i>четыре</i>`, &SendOptions{ParseMode: ModeHTML}, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	expected := []string{"<b>один два &amp;</b>", "<b>три</b> <i>четыре</i>"}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Fatalf("Expected %q, got %q", expected, texts)
+	}
+
+	// Markdown делится только вне сущностей
+	chunks, err = SplitMessage("раз *два три* \\*четыре [a b](http://x.y)",
+		&SendOptions{ParseMode: ModeMarkdownV2}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts = nil
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.Text)
+	}
+	expected = []string{"раз *два три*", "\\*четыре", "[a b](http://x.y)"}
+	if !reflect.DeepEqual(texts, expected) {
+		t.Fatalf("Expected %q, got %q", expected, texts)
+	}
+
+	if _, err := SplitMessage("`"+strings.Repeat("код ", 10)+"`", &SendOptions{ParseMode: ModeMarkdown}, 20); err != ErrCannotSplit {
+		t.Fatal("Expected ErrCannotSplit, got", err)
+	}
+}
@@ -0,0 +1,349 @@
+package telebot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"text/template/parse"
+)
+
+// Templates хранит шаблоны сообщений с вариантами по локалям и
+// превращает их в текст и SendOptions для отправки.
+//
+// Шаблон - текст в синтаксисе text/template с необязательным JSON
+// заголовком между строками "---":
+//
+//	---
+//	{
+//		"parse_mode": "HTML",
+//		"disable_web_page_preview": true,
+//		"keyboard": [[
+//			{"text": "{{t \"menu.start\"}}", "data": "start"},
+//			{"text": "Сайт", "url": "https://example.com"}
+//		]]
+//	}
+//	---
+//	Привет, <b>{{.Name}}</b>!
+//
+// Подставляемые значения экранируются для parse_mode: в HTML шаблон
+// выполняется по правилам html/template, в MarkdownV2 значения
+// экранируются так, что их можно вставлять и внутри сущностей. Старый
+// Markdown не поддерживается: в нем нельзя экранировать символы внутри
+// сущности. Функция raw вставляет значение без экранирования, t переводит
+// строку каталога I18n на язык шаблона.
+// Надписи и данные кнопок - тоже шаблоны, но без экранирования.
+type Templates struct {
+	// I18n задает переводы для функции t и локаль по умолчанию. Может быть nil.
+	I18n *I18n
+
+	mu        sync.RWMutex
+	templates map[string]map[string]*messageTemplate
+}
+
+// NewTemplates создает пустой набор шаблонов. i18n может быть nil.
+func NewTemplates(i18n *I18n) *Templates {
+	return &Templates{
+		I18n:      i18n,
+		templates: make(map[string]map[string]*messageTemplate),
+	}
+}
+
+// LoadDir загружает файлы *.tmpl из каталога dir и его подкаталогов.
+// Имя файла без расширения - имя шаблона, имя подкаталога - локаль:
+// "welcome.tmpl" - вариант по умолчанию, "ru/welcome.tmpl" - для "ru".
+func (t *Templates) LoadDir(dir string) error {
+	return t.loadDir(dir, "")
+}
+
+func (t *Templates) loadDir(dir, locale string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.Name())
+		if f.IsDir() {
+			if locale == "" {
+				if err := t.loadDir(path, f.Name()); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if filepath.Ext(f.Name()) != ".tmpl" {
+			continue
+		}
+		source, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := t.Add(strings.TrimSuffix(f.Name(), ".tmpl"), locale, string(source)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add разбирает шаблон name для локали locale. Пустая локаль задает
+// вариант по умолчанию.
+func (t *Templates) Add(name, locale, source string) error {
+	tmpl, err := parseMessageTemplate(name, source)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.templates == nil {
+		t.templates = make(map[string]map[string]*messageTemplate)
+	}
+	if t.templates[name] == nil {
+		t.templates[name] = make(map[string]*messageTemplate)
+	}
+	t.templates[name][normalizeLocale(locale)] = tmpl
+	return nil
+}
+
+// Render выполняет шаблон name для локали locale с данными data.
+// Если варианта для локали нет, используются базовый язык, локаль по
+// умолчанию I18n и вариант без локали.
+func (t *Templates) Render(name, locale string, data interface{}) (string, *SendOptions, error) {
+	locale = normalizeLocale(locale)
+	tmpl, found := t.lookup(name, locale)
+	if !found {
+		return "", nil, fmt.Errorf("telebot: template '%s' not found", name)
+	}
+
+	translate := func(key string, args ...interface{}) string {
+		if t.I18n == nil {
+			if len(args) == 0 {
+				return key
+			}
+			return fmt.Sprintf(key, args...)
+		}
+		return t.I18n.ForLocale(locale).T(key, args...)
+	}
+	return tmpl.execute(translate, data)
+}
+
+// RenderFor выполняет шаблон на языке пользователя u.
+func (t *Templates) RenderFor(name string, u User, data interface{}) (string, *SendOptions, error) {
+	locale := ""
+	if t.I18n != nil {
+		locale = t.I18n.Locale(u)
+	} else {
+		locale = u.LanguageCode
+	}
+	return t.Render(name, locale, data)
+}
+
+func (t *Templates) lookup(name, locale string) (*messageTemplate, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	locales := []string{locale, baseLanguage(locale)}
+	if t.I18n != nil {
+		locales = append(locales, t.I18n.DefaultLocale, baseLanguage(t.I18n.DefaultLocale))
+	}
+	for _, l := range append(locales, "") {
+		if tmpl, ok := t.templates[name][l]; ok {
+			return tmpl, true
+		}
+	}
+	return nil, false
+}
+
+// templateHeader - JSON заголовок шаблона.
+type templateHeader struct {
+	ParseMode             ParseMode          `json:"parse_mode"`
+	DisableWebPagePreview bool               `json:"disable_web_page_preview"`
+	Keyboard              [][]templateButton `json:"keyboard"`
+}
+
+type templateButton struct {
+	Text        string `json:"text"`
+	Data        string `json:"data"`
+	URL         string `json:"url"`
+	InlineQuery string `json:"inline_query"`
+}
+
+type messageTemplate struct {
+	header templateHeader
+	// Текст выполняется одним из шаблонов в зависимости от ParseMode
+	text *texttemplate.Template
+	html *htmltemplate.Template
+	// Надписи и данные кнопок в порядке Text, Data, URL, InlineQuery
+	buttons [][][4]*texttemplate.Template
+}
+
+// Функции, которые заменяются при каждом выполнении шаблона
+var templatePlaceholders = map[string]interface{}{
+	"t": func(key string, args ...interface{}) string { return key },
+}
+
+func parseMessageTemplate(name, source string) (*messageTemplate, error) {
+	tmpl := &messageTemplate{}
+
+	// Файлы, сохраненные в Windows, разделяют строки "\r\n"
+	source = strings.Replace(source, "\r\n", "\n", -1)
+	body := source
+	if strings.HasPrefix(source, "---\n") {
+		end := strings.Index(source[4:], "\n---")
+		if end < 0 {
+			return nil, fmt.Errorf("telebot: template '%s' has unclosed header", name)
+		}
+		if err := json.Unmarshal([]byte(source[4:4+end]), &tmpl.header); err != nil {
+			return nil, fmt.Errorf("telebot: can't parse header of template '%s': %s", name, err)
+		}
+		body = strings.TrimPrefix(source[4+end+4:], "\n")
+	}
+
+	var err error
+	switch mode := tmpl.header.ParseMode; mode {
+	case ModeHTML:
+		tmpl.html, err = htmltemplate.New(name).
+			Funcs(templatePlaceholders).
+			Funcs(htmltemplate.FuncMap{"raw": func(s string) htmltemplate.HTML { return htmltemplate.HTML(s) }}).
+			Parse(body)
+	case ModeMarkdown:
+		return nil, fmt.Errorf("telebot: template '%s' uses legacy Markdown, use MarkdownV2 or HTML", name)
+	case ModeMarkdownV2:
+		tmpl.text, err = texttemplate.New(name).
+			Funcs(templatePlaceholders).
+			Funcs(texttemplate.FuncMap{
+				"raw": func(s string) rawText { return rawText(s) },
+				"escape": func(args ...interface{}) string {
+					if len(args) == 1 {
+						if raw, ok := args[0].(rawText); ok {
+							return string(raw)
+						}
+					}
+					return EscapeMarkdownV2(fmt.Sprint(args...))
+				},
+			}).
+			Parse(body)
+		if err == nil {
+			for _, t := range tmpl.text.Templates() {
+				escapeActions(t.Tree.Root)
+			}
+		}
+	case ModeDefault:
+		tmpl.text, err = texttemplate.New(name).
+			Funcs(templatePlaceholders).
+			Funcs(texttemplate.FuncMap{"raw": func(s string) string { return s }}).
+			Parse(body)
+	default:
+		return nil, fmt.Errorf("telebot: template '%s' has unknown parse_mode '%s'", name, mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range tmpl.header.Keyboard {
+		var parsed [][4]*texttemplate.Template
+		for _, button := range row {
+			var fields [4]*texttemplate.Template
+			for i, field := range []string{button.Text, button.Data, button.URL, button.InlineQuery} {
+				fields[i], err = texttemplate.New(name).Funcs(templatePlaceholders).Parse(field)
+				if err != nil {
+					return nil, err
+				}
+			}
+			parsed = append(parsed, fields)
+		}
+		tmpl.buttons = append(tmpl.buttons, parsed)
+	}
+	return tmpl, nil
+}
+
+// rawText - значение, которое вставляется в MarkdownV2 без экранирования.
+type rawText string
+
+// escapeActions добавляет escape в конец каждого действия {{...}},
+// которое выводит значение, как это делает html/template.
+func escapeActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(child)
+		}
+	case *parse.ActionNode:
+		if len(n.Pipe.Decl) == 0 {
+			n.Pipe.Cmds = append(n.Pipe.Cmds, &parse.CommandNode{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args:     []parse.Node{parse.NewIdentifier("escape").SetPos(n.Pos)},
+			})
+		}
+	case *parse.IfNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	case *parse.WithNode:
+		escapeActions(n.List)
+		escapeActions(n.ElseList)
+	}
+}
+
+func (tmpl *messageTemplate) execute(translate func(string, ...interface{}) string, data interface{}) (string, *SendOptions, error) {
+	funcs := map[string]interface{}{"t": translate}
+
+	// Исходный шаблон не выполняется: html/template запрещает Clone
+	// после выполнения, а Funcs у общего шаблона - гонка данных
+	var buf bytes.Buffer
+	if tmpl.html != nil {
+		clone, err := tmpl.html.Clone()
+		if err != nil {
+			return "", nil, err
+		}
+		if err := clone.Funcs(funcs).Execute(&buf, data); err != nil {
+			return "", nil, err
+		}
+	} else {
+		clone, err := tmpl.text.Clone()
+		if err != nil {
+			return "", nil, err
+		}
+		if err := clone.Funcs(funcs).Execute(&buf, data); err != nil {
+			return "", nil, err
+		}
+	}
+
+	options := &SendOptions{
+		ParseMode:             tmpl.header.ParseMode,
+		DisableWebPagePreview: tmpl.header.DisableWebPagePreview,
+	}
+	for _, row := range tmpl.buttons {
+		var buttons []KeyboardButton
+		for _, fields := range row {
+			var values [4]string
+			for i, field := range fields {
+				var b bytes.Buffer
+				clone, err := field.Clone()
+				if err != nil {
+					return "", nil, err
+				}
+				if err := clone.Funcs(funcs).Execute(&b, data); err != nil {
+					return "", nil, err
+				}
+				values[i] = b.String()
+			}
+			buttons = append(buttons, KeyboardButton{Text: values[0], Data: values[1], URL: values[2], InlineQuery: values[3]})
+		}
+		options.ReplyMarkup.InlineKeyboard = append(options.ReplyMarkup.InlineKeyboard, buttons)
+	}
+	return strings.TrimSpace(buf.String()), options, nil
+}
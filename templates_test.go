@@ -0,0 +1,97 @@
+package telebot
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "telebot-templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Mkdir(filepath.Join(dir, "ru"), 0755)
+
+	ioutil.WriteFile(filepath.Join(dir, "welcome.tmpl"), []byte(`---
+{
+	"parse_mode": "HTML",
+	"keyboard": [[
+		{"text": "{{t \"menu.start\"}}", "data": "start:{{.ID}}"},
+		{"text": "Site", "url": "https://example.com"}
+	]]
+}
+---
+Hello, <b>{{.Name}}</b>! {{raw "<i>ok</i>"}}
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "ru", "welcome.tmpl"), []byte(`---
+{"parse_mode": "MarkdownV2", "keyboard": [[{"text": "{{t \"menu.start\"}}", "data": "start:{{.ID}}"}]]}
+---
+Привет, *{{.Name}}*{{if .ID}} \(#{{.ID}}\){{end}}! {{raw "_ok_"}}
+`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "plain.tmpl"), []byte("{{.Name}} & <{{t \"menu.start\"}}>\n"), 0644)
+
+	i18n := NewI18n("en", nil)
+	i18n.Add("en", map[string]interface{}{"menu": map[string]interface{}{"start": "Start"}})
+	i18n.Add("ru", map[string]interface{}{"menu": map[string]interface{}{"start": "Начать"}})
+
+	templates := NewTemplates(i18n)
+	if err := templates.LoadDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	data := struct {
+		Name string
+		ID   int
+	}{"<Ив_ан.>", 42}
+
+	text, options, err := templates.Render("welcome", "de", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "Hello, <b>&lt;Ив_ан.&gt;</b>! <i>ok</i>" || options.ParseMode != ModeHTML {
+		t.Fatalf("Wrong HTML template output %q", text)
+	}
+	keyboard := [][]KeyboardButton{{{Text: "Start", Data: "start:42"}, {Text: "Site", URL: "https://example.com"}}}
+	if !reflect.DeepEqual(options.ReplyMarkup.InlineKeyboard, keyboard) {
+		t.Fatal("Wrong keyboard:", options.ReplyMarkup.InlineKeyboard)
+	}
+
+	text, options, err = templates.RenderFor("welcome", User{LanguageCode: "ru-RU"}, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != `Привет, *<Ив\_ан\.\>* \(#42\)! _ok_` || options.ParseMode != ModeMarkdownV2 {
+		t.Fatalf("Wrong MarkdownV2 template output %q", text)
+	}
+	if options.ReplyMarkup.InlineKeyboard[0][0].Text != "Начать" {
+		t.Fatal("Keyboard must be translated:", options.ReplyMarkup.InlineKeyboard)
+	}
+
+	text, options, _ = templates.Render("plain", "ru", data)
+	if text != "<Ив_ан.> & <Начать>" || options.ParseMode != ModeDefault || options.ReplyMarkup.InlineKeyboard != nil {
+		t.Fatalf("Wrong plain template output %q", text)
+	}
+
+	if _, _, err := templates.Render("missing", "en", nil); err == nil {
+		t.Fatal("Expected error for missing template")
+	}
+	if err := templates.Add("bad", "", "---\n{\"parse_mode\": \"BBCode\"}\n---\n"); err == nil {
+		t.Fatal("Expected error for unknown parse mode")
+	}
+	if err := templates.Add("legacy", "", "---\n{\"parse_mode\": \"Markdown\"}\n---\n*{{.Name}}*"); err == nil {
+		t.Fatal("Legacy Markdown can't escape values inside entities and must be rejected")
+	}
+
+	// Заголовок в файле с переводами строк Windows
+	crlf := "---\r\n{\"parse_mode\": \"MarkdownV2\"}\r\n---\r\n*{{.Name}}*\r\n"
+	if err := templates.Add("crlf", "", crlf); err != nil {
+		t.Fatal(err)
+	}
+	text, options, _ = templates.Render("crlf", "", data)
+	if text != `*<Ив\_ан\.\>*` || options.ParseMode != ModeMarkdownV2 {
+		t.Fatalf("CRLF header is not parsed: %q %s", text, options.ParseMode)
+	}
+}
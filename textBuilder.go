@@ -0,0 +1,93 @@
+package telebot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TextBuilder собирает форматированный текст из частей. Все значения
+// экранируются для выбранного ParseMode, поэтому в текст можно подставлять
+// имена пользователей и другие данные извне.
+//
+//	text, options := NewTextBuilder(ModeHTML).
+//		Text("Привет, ").Mention(user.FirstName, user.ID).Text("!\n").
+//		Bold("Баланс: ").Code(balance).
+//		Build()
+//	bot.SendMessage(chat, text, options)
+//
+// С ModeDefault оформление передается в SendOptions.Entities.
+type TextBuilder struct {
+	mode     ParseMode
+	text     strings.Builder
+	offset   int
+	entities []MessageEntity
+}
+
+func NewTextBuilder(mode ParseMode) *TextBuilder {
+	return &TextBuilder{mode: mode}
+}
+
+// Text добавляет текст без оформления.
+func (b *TextBuilder) Text(s string) *TextBuilder {
+	b.text.WriteString(s)
+	b.offset += utf16Len(s)
+	return b
+}
+
+// Textf добавляет текст без оформления по формату fmt.Sprintf.
+func (b *TextBuilder) Textf(format string, args ...interface{}) *TextBuilder {
+	return b.Text(fmt.Sprintf(format, args...))
+}
+
+func (b *TextBuilder) Bold(s string) *TextBuilder {
+	return b.entity(MessageEntity{Type: "bold"}, s)
+}
+
+func (b *TextBuilder) Italic(s string) *TextBuilder {
+	return b.entity(MessageEntity{Type: "italic"}, s)
+}
+
+// Code добавляет моноширинный текст внутри строки.
+func (b *TextBuilder) Code(s string) *TextBuilder {
+	return b.entity(MessageEntity{Type: "code"}, s)
+}
+
+// Pre добавляет блок кода. language можно не указывать.
+func (b *TextBuilder) Pre(s, language string) *TextBuilder {
+	return b.entity(MessageEntity{Type: "pre", Language: language}, s)
+}
+
+// Link добавляет текст со ссылкой на url.
+func (b *TextBuilder) Link(text, url string) *TextBuilder {
+	return b.entity(MessageEntity{Type: "text_link", Url: url}, text)
+}
+
+// Mention добавляет упоминание пользователя по ID, в том числе
+// пользователя без username.
+func (b *TextBuilder) Mention(text string, userID int) *TextBuilder {
+	return b.entity(MessageEntity{Type: "text_mention", User: User{ID: userID}}, text)
+}
+
+func (b *TextBuilder) entity(e MessageEntity, s string) *TextBuilder {
+	e.Offset = b.offset
+	e.Length = utf16Len(s)
+	if e.Length > 0 {
+		b.entities = append(b.entities, e)
+	}
+	return b.Text(s)
+}
+
+// String возвращает текст в разметке ParseMode построителя.
+func (b *TextBuilder) String() string {
+	return RenderEntities(b.text.String(), b.entities, b.mode)
+}
+
+// Build возвращает текст и SendOptions с нужным ParseMode или, для
+// ModeDefault, с сущностями текста.
+func (b *TextBuilder) Build() (string, *SendOptions) {
+	options := &SendOptions{ParseMode: b.mode}
+	if b.mode == ModeDefault {
+		options.Entities = append([]MessageEntity(nil), b.entities...)
+	}
+	return b.String(), options
+}
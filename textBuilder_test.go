@@ -0,0 +1,45 @@
+package telebot
+
+import "testing"
+
+func TestTextBuilder(t *testing.T) {
+	// Имя пользователя с разметкой каждого из режимов
+	name := "<b>Ив_ан</b> *[x](y)."
+
+	build := func(mode ParseMode) (string, *SendOptions) {
+		return NewTextBuilder(mode).
+			Text("Привет, ").Mention(name, 42).Text("! ").
+			Bold("Баланс:").Textf(" %d.%02d ", 10, 5).Code("a`b").
+			Link("сайт", "https://example.com/(1)").
+			Build()
+	}
+
+	cases := map[ParseMode]string{
+		ModeHTML: `Привет, <a href="tg://user?id=42">&lt;b&gt;Ив_ан&lt;/b&gt; *[x](y).</a>! ` +
+			`<b>Баланс:</b> 10.05 <code>a` + "`" + `b</code><a href="https://example.com/(1)">сайт</a>`,
+		ModeMarkdownV2: `Привет, [<b\>Ив\_ан</b\> \*\[x\]\(y\)\.](tg://user?id=42)\! ` +
+			`*Баланс:* 10\.05 ` + "`a\\`b`" + `[сайт](https://example.com/(1\))`,
+		// Устаревший Markdown не экранирует внутри сущностей: разделитель
+		// пишется между частями сущности, а ссылка с ] остается текстом
+		ModeMarkdown: `Привет, <b>Ив\_ан</b> \*\[x](y).! ` +
+			`*Баланс:* 10.05 ` + "`a`\\``b`" + `[сайт](https://example.com/(1%29)`,
+	}
+	for mode, expected := range cases {
+		text, options := build(mode)
+		if text != expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", mode, expected, text)
+		}
+		if options.ParseMode != mode || options.Entities != nil {
+			t.Errorf("%s: wrong options %+v", mode, options)
+		}
+	}
+
+	text, options := build(ModeDefault)
+	if text != "Привет, "+name+"! Баланс: 10.05 a`bсайт" {
+		t.Fatal("Wrong plain text:", text)
+	}
+	if len(options.Entities) != 4 || options.Entities[0].Type != "text_mention" ||
+		options.Entities[0].Offset != 8 || options.Entities[0].Length != utf16Len(name) {
+		t.Fatal("Wrong entities:", options.Entities)
+	}
+}
@@ -0,0 +1,75 @@
+package telebot
+
+import (
+	"time"
+)
+
+// Limit описывает ограничение частоты: не более Count событий за период Per.
+// Burst задает емкость корзины, по умолчанию равную Count.
+type Limit struct {
+	Count int
+	Per   time.Duration
+	Burst int
+}
+
+// IsZero возвращает true, если ограничение не задано.
+func (l Limit) IsZero() bool {
+	return l.Count <= 0 || l.Per <= 0
+}
+
+// tokenBucket - классическая корзина токенов. Не потокобезопасна,
+// синхронизацию обеспечивает владелец.
+type tokenBucket struct {
+	capacity float64
+	rate     float64 // токенов в наносекунду
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(l Limit, now time.Time) *tokenBucket {
+	capacity := l.Burst
+	if capacity <= 0 {
+		capacity = l.Count
+	}
+	return &tokenBucket{
+		capacity: float64(capacity),
+		rate:     float64(l.Count) / float64(l.Per),
+		tokens:   float64(capacity),
+		last:     now,
+	}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	if now.After(tb.last) {
+		tb.tokens += float64(now.Sub(tb.last)) * tb.rate
+		if tb.tokens > tb.capacity {
+			tb.tokens = tb.capacity
+		}
+		tb.last = now
+	}
+}
+
+// take забирает токен, если он есть.
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.refill(now)
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
+
+// delay возвращает время, через которое в корзине появится токен.
+func (tb *tokenBucket) delay(now time.Time) time.Duration {
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate)
+}
+
+// full говорит, что корзина давно не использовалась и ее можно удалить.
+func (tb *tokenBucket) full(now time.Time) bool {
+	tb.refill(now)
+	return tb.tokens >= tb.capacity
+}